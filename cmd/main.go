@@ -1,15 +1,25 @@
 package main
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"time"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kartikeya55555/fetch-assignment/internal/auth"
 	"github.com/kartikeya55555/fetch-assignment/internal/aws"
 	"github.com/kartikeya55555/fetch-assignment/internal/config"
 	"github.com/kartikeya55555/fetch-assignment/internal/handlers"
+	"github.com/kartikeya55555/fetch-assignment/internal/health"
+	"github.com/kartikeya55555/fetch-assignment/internal/logging"
+	"github.com/kartikeya55555/fetch-assignment/internal/metrics"
+	"github.com/kartikeya55555/fetch-assignment/internal/ratelimit"
 	"github.com/kartikeya55555/fetch-assignment/internal/receipt"
+	"github.com/kartikeya55555/fetch-assignment/internal/tracing"
 	"github.com/kartikeya55555/fetch-assignment/internal/worker"
 )
 
@@ -17,71 +27,252 @@ func main() {
 	// 1) Load configuration
 	cfg := config.LoadConfig()
 
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		fatal("Invalid LOG_LEVEL", "error", err)
+	}
+	logger := logging.New(os.Stdout, level)
+	// Packages without an injected logger, and the standard log package, use it too
+	slog.SetDefault(logger)
+	// Debug mode prints plain-text route and warning lines to stdout, between
+	// the JSON logs; requests are logged through logging.Gin instead
+	gin.SetMode(gin.ReleaseMode)
+
+	runAPI, runWorker := false, false
+	switch cfg.ServiceType {
+	case config.ServiceTypeAPI:
+		runAPI = true
+	case config.ServiceTypeWorker:
+		runWorker = true
+	case config.ServiceTypeAll:
+		runAPI, runWorker = true, true
+	default:
+		fatal("Unknown SERVICE_TYPE (expected api, worker or all)", "service_type", cfg.ServiceType)
+	}
+
+	// Split processes only see each other's results through a shared store
+	if cfg.ServiceType != config.ServiceTypeAll && cfg.StoreType == "memory" {
+		fatal("SERVICE_TYPE needs a shared store; set STORE_TYPE=sqlite", "service_type", cfg.ServiceType)
+	}
+
+	// Cancelled on SIGINT/SIGTERM; startup and both roles stop on it
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.TracingExporter, "fetch-assignment-"+cfg.ServiceType)
+	if err != nil {
+		fatal("Failed to set up tracing", "error", err)
+	}
+
 	// 2) Set up AWS clients (SQS, SNS)
-	sqsClient := aws.NewSQSClient(cfg.AWSRegion, cfg.AWSEndpoint, cfg.SQSQueueName)
-	snsClient := aws.NewSNSClient(cfg.AWSRegion, cfg.AWSEndpoint, cfg.SNSTopicName)
+	sqsClient := aws.NewSQSClient(cfg.AWSRegion, cfg.AWSEndpoint, cfg.SQSQueueName, cfg.MaxReceiveCount, logger)
 
-	// Ensure the queue and topic exist
-	if err := sqsClient.EnsureQueue(); err != nil {
-		log.Fatalf("Failed to ensure queue: %v", err)
+	// Ensure the queue exists (both roles need its URL)
+	if err := sqsClient.EnsureQueue(ctx); err != nil {
+		fatal("Failed to ensure queue", "error", err)
 	}
-	if err := snsClient.EnsureTopic(); err != nil {
-		log.Fatalf("Failed to ensure topic: %v", err)
+	if err := metrics.RegisterQueueDepth(sqsClient.QueueDepth); err != nil {
+		fatal("Failed to register queue metrics", "error", err)
 	}
 
-	// 3) Create a single in-memory store shared by both API & worker
-	store := receipt.NewInMemoryStore()
+	// 3) Create the store; with SERVICE_TYPE=all it is shared by both API & worker
+	store, err := receipt.NewStore(cfg.StoreType, cfg.StorePath)
+	if err != nil {
+		fatal("Failed to open store", "store_type", cfg.StoreType, "error", err)
+	}
+	defer store.Close()
+	store = receipt.NewTracedStore(store)
+	if err := metrics.RegisterStoreSize(store.CountReceipts); err != nil {
+		fatal("Failed to register store metrics", "error", err)
+	}
+	ledger, err := receipt.NewLedgerStore(cfg.StoreType, cfg.StorePath)
+	if err != nil {
+		fatal("Failed to open ledger", "store_type", cfg.StoreType, "error", err)
+	}
+	defer ledger.Close()
+	ledger = receipt.NewTracedLedgerStore(ledger)
 	calc := receipt.NewDefaultPointsCalculator()
-	service := receipt.NewReceiptService(store, calc)
+	if cfg.PointsRulesFile != "" {
+		rulesCfg, err := receipt.LoadRulesConfig(cfg.PointsRulesFile)
+		if err != nil {
+			fatal("Failed to load points rules", "error", err)
+		}
+		if calc, err = receipt.NewRulePointsCalculator(rulesCfg); err != nil {
+			fatal("Invalid points rules", "path", cfg.PointsRulesFile, "error", err)
+		}
+		logger.Info("Loaded points rules", "path", cfg.PointsRulesFile)
+	}
+	service := receipt.NewReceiptService(store, calc,
+		receipt.WithIdempotencyWindow(cfg.IdempotencyWindow),
+		receipt.WithLedger(ledger),
+		receipt.WithLogger(logger),
+	)
 
-	// 4) Start the worker in a separate goroutine
-	go func() {
-		log.Println("Starting worker loop...")
-		processor := worker.NewProcessor(sqsClient, snsClient, service)
-
-		for {
-			messages, err := sqsClient.GetMessages()
-			if err != nil {
-				log.Printf("Error receiving messages: %v\n", err)
-				time.Sleep(2 * time.Second)
-				continue
-			}
-
-			for _, msg := range messages {
-				if msg.Body == nil {
-					continue
-				}
-				log.Printf("Worker received message: %s\n", *msg.Body)
-
-				if err := processor.ProcessMessage(msg); err != nil {
-					log.Printf("Error processing message: %v\n", err)
-					// optionally skip DeleteMessage if you want to retry
-					continue
-				}
-				// Delete message if processed successfully
-				sqsClient.DeleteMessage(msg.ReceiptHandle)
-				log.Println("Message processed and removed from queue.")
-			}
-
-			time.Sleep(2 * time.Second)
+	// /livez fails only on problems a restart fixes; /readyz also fails while
+	// a dependency is unreachable
+	live := health.NewChecker(cfg.HealthTimeout)
+	ready := health.NewChecker(cfg.HealthTimeout)
+	ready.Add("store", store.Ping)
+	ready.Add("sqs", sqsClient.CheckQueue)
+
+	// 4) Start the worker in the background; workerDone closes once in-flight messages finish
+	var workerDone chan struct{}
+	if runWorker {
+		snsClient := aws.NewSNSClient(cfg.AWSRegion, cfg.AWSEndpoint, cfg.SNSTopicName, logger)
+		if err := snsClient.EnsureTopic(ctx); err != nil {
+			fatal("Failed to ensure topic", "error", err)
 		}
-	}()
+		ready.Add("sns", snsClient.CheckTopic)
+
+		pool := newWorkerPool(cfg, sqsClient, snsClient, service, logger)
+		heartbeat := health.Fresh(pool.LastActive, cfg.HeartbeatTimeout)
+		live.Add("worker", heartbeat)
+		ready.Add("worker", heartbeat)
+
+		workerDone = make(chan struct{})
+		go func() {
+			defer close(workerDone)
+			pool.Run(ctx)
+		}()
+	}
+
+	// 5) Start the HTTP server in the background; a worker-only process still
+	// serves the probes and /metrics on PORT
+	r := newRouter(logger, live, ready, cfg.MetricsToken)
+	if runAPI {
+		authn, err := newAuthenticator(cfg, logger)
+		if err != nil {
+			fatal("Failed to set up authentication", "error", err)
+		}
+		addAPIRoutes(r, cfg, service, sqsClient, authn, logger)
+	}
+	srv := serve(cfg, r, logger)
+
+	// 6) Wait for a shutdown signal, then drain both roles within the deadline
+	<-ctx.Done()
+	logger.Info("Shutdown signal received, draining", "timeout", cfg.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("API server did not shut down cleanly", "error", err)
+	}
+	if workerDone != nil {
+		select {
+		case <-workerDone:
+		case <-shutdownCtx.Done():
+			logger.Warn("Timed out waiting for in-flight messages; they will be redelivered")
+		}
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("Failed to flush traces", "error", err)
+	}
+	logger.Info("Shutdown complete")
+}
+
+// fatal logs msg at error level and exits; before LOG_LEVEL is read it goes
+// to the standard logger.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
 
-	// 5) Set up the API (Gin)
-	r := gin.Default()
+// newWorkerPool builds the consumer pool; Run processes messages until its
+// ctx is cancelled and in-flight messages are done.
+func newWorkerPool(cfg *config.Config, sqsClient aws.SQSClient, snsClient aws.SNSClient, service receipt.ReceiptService, logger *slog.Logger) worker.Pool {
+	processor := worker.NewProcessor(sqsClient, snsClient, service, cfg.SQSQueueName, logger)
+	return worker.NewPool(sqsClient, processor, cfg.WorkerConcurrency, cfg.WorkerBatchSize, cfg.WorkerIdleBackoff, logger)
+}
+
+// newAuthenticator accepts the configured API keys and JWKS-signed bearer
+// tokens. It fails closed: without either the API refuses to start, unless
+// AUTH_DISABLED lets every request through as an admin.
+func newAuthenticator(cfg *config.Config, logger *slog.Logger) (auth.Authenticator, error) {
+	if cfg.AuthDisabled {
+		logger.Warn("AUTH_DISABLED is set, every request is treated as an admin")
+		return auth.AllowAll(), nil
+	}
+	if cfg.APIKeysFile == "" && cfg.JWKSFile == "" {
+		return nil, fmt.Errorf("no credentials configured: set API_KEYS_FILE and/or JWKS_FILE, or AUTH_DISABLED=true for local development")
+	}
+
+	var keys []auth.APIKey
+	if cfg.APIKeysFile != "" {
+		var err error
+		if keys, err = auth.LoadAPIKeys(cfg.APIKeysFile); err != nil {
+			return nil, err
+		}
+		logger.Info("Loaded API keys", "count", len(keys), "path", cfg.APIKeysFile)
+	}
+	var jwks *auth.JWKS
+	if cfg.JWKSFile != "" {
+		var err error
+		if jwks, err = auth.LoadJWKS(cfg.JWKSFile); err != nil {
+			return nil, err
+		}
+		logger.Info("Accepting bearer tokens", "jwks", cfg.JWKSFile)
+	}
+	return auth.NewAuthenticator(keys, jwks, cfg.JWTIssuer, cfg.JWTAudience), nil
+}
 
+// addAPIRoutes sets up the receipt and user routes on r.
+func addAPIRoutes(r *gin.Engine, cfg *config.Config, service receipt.ReceiptService, sqsClient aws.SQSClient, authn auth.Authenticator, logger *slog.Logger) {
 	// Handler that knows how to queue receipts
-	receiptHandler := handlers.NewReceiptHandler(service, sqsClient)
+	receiptHandler := handlers.NewReceiptHandler(service, sqsClient, logger, cfg.BatchMaxReceipts, cfg.BatchMaxBytes)
+
+	// Everything else needs credentials, and the scope named on each route
+	api := r.Group("/", auth.Middleware(authn))
+	submit, read, admin := auth.Require(auth.ScopeSubmit), auth.Require(auth.ScopeRead), auth.Require(auth.ScopeAdmin)
+	self, owner := auth.RequireSelf("id"), auth.RequireOwner("id")
+
+	// Submissions are limited per client so no one can flood the queue; a
+	// batch is charged one submission per receipt
+	limit := func(c *gin.Context) { c.Next() }
+	if cfg.RateLimitPerMin > 0 {
+		limit = ratelimit.Middleware(ratelimit.NewTokenBucket(cfg.RateLimitPerMin, cfg.RateLimitBurst))
+	}
 
-	r.POST("/receipts/process", receiptHandler.QueueReceipt)
-	r.GET("/receipts/:id/points", receiptHandler.GetReceiptPoints)
+	api.POST("/receipts/process", submit, limit, receiptHandler.QueueReceipt)
+	api.POST("/receipts/batch", submit, limit, receiptHandler.QueueReceiptBatch)
+	api.GET("/receipts", read, receiptHandler.ListReceipts)
+	api.GET("/receipts/:id", read, receiptHandler.GetReceipt)
+	api.GET("/receipts/:id/points", read, receiptHandler.GetReceiptPoints)
+	api.GET("/receipts/:id/breakdown", read, receiptHandler.GetReceiptBreakdown)
+	api.POST("/receipts/:id/reprocess", admin, receiptHandler.ReprocessReceipt)
+	api.POST("/receipts/:id/flag", admin, receiptHandler.FlagReceipt)
+	api.GET("/users/:id/points", read, self, receiptHandler.GetUserPoints)
+	api.GET("/users/:id/receipts", read, self, receiptHandler.ListUserReceipts)
+	api.GET("/users/:id/ledger", read, self, receiptHandler.GetUserLedger)
+	api.POST("/users/:id/redemptions", submit, owner, receiptHandler.RedeemPoints)
+}
+
+// newRouter returns a Gin engine that logs, traces and measures every request
+// and serves the probe and /metrics endpoints of every role. The probes are
+// unauthenticated; /metrics requires metricsToken if it is set.
+func newRouter(logger *slog.Logger, live, ready health.Checker, metricsToken string) *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery(), logging.Gin(logger), tracing.Gin(), metrics.Gin())
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "API is running"})
 	})
+	r.GET("/livez", health.Handler(live))
+	r.GET("/readyz", health.Handler(ready))
+	r.GET("/metrics", metrics.Handler(metricsToken))
+	return r
+}
 
-	// 6) Run the API server in the main goroutine
-	log.Printf("Starting unified API+Worker on port %s...\n", cfg.Port)
-	if err := r.Run(":" + cfg.Port); err != nil {
-		log.Fatalf("Failed to run API server: %v", err)
+// serve runs handler on PORT in the background; the returned server is
+// stopped with Shutdown.
+func serve(cfg *config.Config, handler http.Handler, logger *slog.Logger) *http.Server {
+	srv := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: handler,
 	}
+	go func() {
+		logger.Info("Starting service", "service_type", cfg.ServiceType, "port", cfg.Port)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal("Failed to run API server", "error", err)
+		}
+	}()
+	return srv
 }
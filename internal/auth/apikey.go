@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// APIKey is a static key as configured: only its SHA-256 hash is stored.
+type APIKey struct {
+	ID     string // name used in logs, never the key itself
+	Hash   string // hex SHA-256 of the key
+	Scopes []Scope
+}
+
+// HashAPIKey returns the hex SHA-256 of key, as stored in the keys file.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeysFile is the JSON layout of API_KEYS_FILE.
+type apiKeysFile struct {
+	Keys []struct {
+		ID     string   `json:"id"`
+		SHA256 string   `json:"sha256"`
+		Scopes []string `json:"scopes"`
+	} `json:"keys"`
+}
+
+// LoadAPIKeys reads the API keys file at path.
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read API keys file: %w", err)
+	}
+	var file apiKeysFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse API keys file: %w", err)
+	}
+
+	keys := make([]APIKey, 0, len(file.Keys))
+	for i, k := range file.Keys {
+		hash := strings.ToLower(k.SHA256)
+		if k.ID == "" {
+			return nil, fmt.Errorf("API key %d has no id", i)
+		}
+		if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("API key %q: sha256 must be 64 hex characters", k.ID)
+		}
+		key := APIKey{ID: k.ID, Hash: hash}
+		for _, s := range k.Scopes {
+			scope, err := parseScope(s)
+			if err != nil {
+				return nil, fmt.Errorf("API key %q: %w", k.ID, err)
+			}
+			key.Scopes = append(key.Scopes, scope)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
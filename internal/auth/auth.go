@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/kartikeya55555/fetch-assignment/internal/errors"
+)
+
+// Scope is a permission granted to an API key or token.
+type Scope string
+
+const (
+	ScopeSubmit Scope = "submit" // submit receipts and redeem points
+	ScopeRead   Scope = "read"   // read receipts, points and ledgers
+	ScopeAdmin  Scope = "admin"  // everything, including reprocessing; implies the other scopes
+)
+
+func parseScope(s string) (Scope, error) {
+	switch scope := Scope(s); scope {
+	case ScopeSubmit, ScopeRead, ScopeAdmin:
+		return scope, nil
+	default:
+		return "", fmt.Errorf("unknown scope %q", s)
+	}
+}
+
+// Principal is the authenticated caller.
+type Principal struct {
+	ID string // API key ID or token subject; empty when authentication is disabled
+	// UserID is the end user the caller acts as. It is set for JWTs (their
+	// subject) and empty for API keys, which are trusted to act for any user.
+	UserID string
+	Scopes []Scope
+}
+
+// HasScope reports whether p was granted scope, directly or through admin.
+func (p *Principal) HasScope(scope Scope) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// RestrictedTo returns the only user whose data p may see: the subject of a
+// bearer token without admin. Admins and API keys are not restricted and get
+// "".
+func (p *Principal) RestrictedTo() string {
+	if p.HasScope(ScopeAdmin) {
+		return ""
+	}
+	return p.UserID
+}
+
+// Authenticator identifies the caller of a request.
+type Authenticator interface {
+	// Authenticate returns the request's principal, or an error wrapping
+	// errors.ErrUnauthenticated.
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// APIKeyHeader carries a static API key.
+const APIKeyHeader = "X-API-Key"
+
+type authenticator struct {
+	apiKeys map[string]APIKey // by Hash
+	tokens  *tokenVerifier    // nil when JWTs are not accepted
+}
+
+// NewAuthenticator accepts the given API keys in the X-API-Key header and, if
+// jwks is non-nil, JWT bearer tokens signed by one of its keys. issuer and
+// audience, when non-empty, must match the token's iss and aud claims.
+func NewAuthenticator(keys []APIKey, jwks *JWKS, issuer, audience string) Authenticator {
+	a := &authenticator{apiKeys: make(map[string]APIKey, len(keys))}
+	for _, k := range keys {
+		a.apiKeys[k.Hash] = k
+	}
+	if jwks != nil {
+		a.tokens = newTokenVerifier(jwks, issuer, audience)
+	}
+	return a
+}
+
+func (a *authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		k, ok := a.apiKeys[HashAPIKey(key)]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown API key", errors.ErrUnauthenticated)
+		}
+		return &Principal{ID: k.ID, Scopes: k.Scopes}, nil
+	}
+
+	header := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		return nil, fmt.Errorf("%w: no API key or bearer token", errors.ErrUnauthenticated)
+	}
+	if a.tokens == nil {
+		return nil, fmt.Errorf("%w: bearer tokens are not accepted", errors.ErrUnauthenticated)
+	}
+	return a.tokens.verify(token)
+}
+
+type allowAll struct{}
+
+// AllowAll authenticates every request as an admin. It is only meant for
+// local development, with AUTH_DISABLED set.
+func AllowAll() Authenticator {
+	return allowAll{}
+}
+
+func (allowAll) Authenticate(r *http.Request) (*Principal, error) {
+	return &Principal{Scopes: []Scope{ScopeAdmin}}, nil
+}
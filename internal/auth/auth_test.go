@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kartikeya55555/fetch-assignment/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var hmacSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// writeFile writes v as JSON to a temp file and returns its path.
+func writeFile(t *testing.T, name string, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+// testAuthenticator accepts the API key "secret-key" (submit, read) and
+// tokens signed by hmacSecret ("hs") or rsaKey ("rs").
+func testAuthenticator(t *testing.T, rsaKey *rsa.PrivateKey) Authenticator {
+	t.Helper()
+	keys, err := LoadAPIKeys(writeFile(t, "keys.json", map[string]interface{}{
+		"keys": []map[string]interface{}{
+			{"id": "checkout", "sha256": HashAPIKey("secret-key"), "scopes": []string{"submit", "read"}},
+			{"id": "ops", "sha256": HashAPIKey("admin-key"), "scopes": []string{"admin"}},
+		},
+	}))
+	require.NoError(t, err)
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks, err := LoadJWKS(writeFile(t, "jwks.json", map[string]interface{}{
+		"keys": []map[string]string{
+			{"kid": "hs", "kty": "oct", "k": b64(hmacSecret)},
+			{"kid": "rs", "kty": "RSA", "alg": "RS256", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		},
+	}))
+	require.NoError(t, err)
+	return NewAuthenticator(keys, jwks, "test-issuer", "")
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   "alice",
+		"iss":   "test-issuer",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "read submit other:scope",
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	a := testAuthenticator(t, rsaKey)
+
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	wrongIssuer := validClaims()
+	wrongIssuer["iss"] = "someone-else"
+
+	tests := []struct {
+		name    string
+		header  string
+		value   string
+		wantID  string
+		wantErr bool
+	}{
+		{"API key", APIKeyHeader, "secret-key", "checkout", false},
+		{"Unknown API key", APIKeyHeader, "guess", "", true},
+		{"HS256 token", "Authorization", "Bearer " + sign(t, jwt.SigningMethodHS256, "hs", hmacSecret, validClaims()), "alice", false},
+		{"RS256 token", "Authorization", "Bearer " + sign(t, jwt.SigningMethodRS256, "rs", rsaKey, validClaims()), "alice", false},
+		{"Expired token", "Authorization", "Bearer " + sign(t, jwt.SigningMethodHS256, "hs", hmacSecret, expired), "", true},
+		{"Wrong issuer", "Authorization", "Bearer " + sign(t, jwt.SigningMethodHS256, "hs", hmacSecret, wrongIssuer), "", true},
+		{"Unknown kid", "Authorization", "Bearer " + sign(t, jwt.SigningMethodHS256, "nope", hmacSecret, validClaims()), "", true},
+		// HS256 signed with the RSA key's kid must not verify against it
+		{"Algorithm mismatch", "Authorization", "Bearer " + sign(t, jwt.SigningMethodHS256, "rs", hmacSecret, validClaims()), "", true},
+		{"No credentials", "", "", "", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/receipts", nil)
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			p, err := a.Authenticate(req)
+			if tc.wantErr {
+				assert.ErrorIs(t, err, errors.ErrUnauthenticated)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantID, p.ID)
+			assert.True(t, p.HasScope(ScopeRead))
+			assert.False(t, p.HasScope(ScopeAdmin))
+		})
+	}
+}
+
+func TestMiddleware_EnforcesScopesAndUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	r := gin.New()
+	api := r.Group("/", Middleware(testAuthenticator(t, rsaKey)))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	api.POST("/receipts/:id/reprocess", Require(ScopeAdmin), ok)
+	api.GET("/users/:id/points", Require(ScopeRead), RequireSelf("id"), ok)
+	api.POST("/users/:id/redemptions", Require(ScopeSubmit), RequireOwner("id"), ok)
+
+	token := "Bearer " + sign(t, jwt.SigningMethodHS256, "hs", hmacSecret, validClaims())
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		value  string
+		want   int
+	}{
+		{"No credentials", http.MethodGet, "/users/alice/points", "", "", http.StatusUnauthorized},
+		{"Missing scope", http.MethodPost, "/receipts/r1/reprocess", APIKeyHeader, "secret-key", http.StatusForbidden},
+		{"Own points", http.MethodGet, "/users/alice/points", "Authorization", token, http.StatusOK},
+		{"Another user's points", http.MethodGet, "/users/bob/points", "Authorization", token, http.StatusForbidden},
+		{"API key acts for any user", http.MethodGet, "/users/bob/points", APIKeyHeader, "secret-key", http.StatusOK},
+		{"Own redemption", http.MethodPost, "/users/alice/redemptions", "Authorization", token, http.StatusOK},
+		{"Another user's redemption", http.MethodPost, "/users/bob/redemptions", "Authorization", token, http.StatusForbidden},
+		{"Submit API key cannot redeem", http.MethodPost, "/users/alice/redemptions", APIKeyHeader, "secret-key", http.StatusForbidden},
+		{"Admin API key redeems for any user", http.MethodPost, "/users/alice/redemptions", APIKeyHeader, "admin-key", http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tc.want, w.Code)
+		})
+	}
+}
+
+func TestLoadAPIKeys_RejectsBadEntries(t *testing.T) {
+	_, err := LoadAPIKeys(writeFile(t, "keys.json", map[string]interface{}{
+		"keys": []map[string]interface{}{{"id": "k", "sha256": "not-hex", "scopes": []string{"read"}}},
+	}))
+	assert.Error(t, err)
+
+	_, err = LoadAPIKeys(writeFile(t, "keys.json", map[string]interface{}{
+		"keys": []map[string]interface{}{{"id": "k", "sha256": HashAPIKey("x"), "scopes": []string{"superuser"}}},
+	}))
+	assert.Error(t, err)
+}
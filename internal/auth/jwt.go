@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kartikeya55555/fetch-assignment/internal/errors"
+)
+
+// JWKS holds the verification keys from a JSON Web Key Set, by key ID.
+type JWKS struct {
+	keys map[string]jwk
+}
+
+// jwk is one verification key and the only algorithm it may be used with,
+// so an RSA public key can never be passed off as an HMAC secret.
+type jwk struct {
+	alg string
+	key interface{} // []byte for HS256, *rsa.PublicKey for RS256
+}
+
+// jwksFile is the RFC 7517 layout, limited to the fields used here.
+type jwksFile struct {
+	Keys []struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Alg string `json:"alg"`
+		K   string `json:"k"` // oct
+		N   string `json:"n"` // RSA
+		E   string `json:"e"` // RSA
+	} `json:"keys"`
+}
+
+// LoadJWKS reads the JWKS file at path. "oct" keys verify HS256 tokens and
+// "RSA" keys verify RS256 tokens.
+func LoadJWKS(path string) (*JWKS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read JWKS file: %w", err)
+	}
+	var file jwksFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse JWKS file: %w", err)
+	}
+
+	set := &JWKS{keys: make(map[string]jwk, len(file.Keys))}
+	for i, k := range file.Keys {
+		var key jwk
+		switch k.Kty {
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil || len(secret) == 0 {
+				return nil, fmt.Errorf("JWKS key %d: invalid oct key", i)
+			}
+			key = jwk{alg: "HS256", key: secret}
+		case "RSA":
+			pub, err := rsaPublicKey(k.N, k.E)
+			if err != nil {
+				return nil, fmt.Errorf("JWKS key %d: %w", i, err)
+			}
+			key = jwk{alg: "RS256", key: pub}
+		default:
+			return nil, fmt.Errorf("JWKS key %d: unsupported kty %q", i, k.Kty)
+		}
+		if k.Alg != "" && k.Alg != key.alg {
+			return nil, fmt.Errorf("JWKS key %d: alg %q does not match kty %q", i, k.Alg, k.Kty)
+		}
+		set.keys[k.Kid] = key
+	}
+	return set, nil
+}
+
+func rsaPublicKey(n, e string) (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil || len(nb) == 0 {
+		return nil, fmt.Errorf("invalid RSA modulus")
+	}
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil || len(eb) == 0 {
+		return nil, fmt.Errorf("invalid RSA exponent")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nb),
+		E: int(new(big.Int).SetBytes(eb).Int64()),
+	}, nil
+}
+
+// lookup finds the key for kid; a token without a kid is accepted only when
+// the set has a single key.
+func (s *JWKS) lookup(kid string) (jwk, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, k := range s.keys {
+			return k, true
+		}
+	}
+	k, ok := s.keys[kid]
+	return k, ok
+}
+
+// tokenClaims are the claims read from a bearer token; scope is the
+// space-separated OAuth 2.0 form.
+type tokenClaims struct {
+	Scope string `json:"scope"`
+	jwt.RegisteredClaims
+}
+
+type tokenVerifier struct {
+	jwks   *JWKS
+	parser *jwt.Parser
+}
+
+func newTokenVerifier(jwks *JWKS, issuer, audience string) *tokenVerifier {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "RS256"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+	}
+	if issuer != "" {
+		opts = append(opts, jwt.WithIssuer(issuer))
+	}
+	if audience != "" {
+		opts = append(opts, jwt.WithAudience(audience))
+	}
+	return &tokenVerifier{jwks: jwks, parser: jwt.NewParser(opts...)}
+}
+
+func (v *tokenVerifier) verify(raw string) (*Principal, error) {
+	var claims tokenClaims
+	_, err := v.parser.ParseWithClaims(raw, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		k, ok := v.jwks.lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		if t.Method.Alg() != k.alg {
+			return nil, fmt.Errorf("key %q does not accept %s", kid, t.Method.Alg())
+		}
+		return k.key, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrUnauthenticated, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: token has no subject", errors.ErrUnauthenticated)
+	}
+
+	p := &Principal{ID: claims.Subject, UserID: claims.Subject}
+	for _, s := range strings.Fields(claims.Scope) {
+		// Tokens may carry scopes meant for other services; ignore those
+		if scope, err := parseScope(s); err == nil {
+			p.Scopes = append(p.Scopes, scope)
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// principalKey is where Middleware stores the Principal in the gin context.
+const principalKey = "auth.principal"
+
+// Middleware answers 401 to requests a cannot authenticate and
+// records the Principal of the rest for Require and PrincipalFrom.
+func Middleware(a Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, err := a.Authenticate(c.Request)
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "Rejected unauthenticated request", "method", c.Request.Method, "route", c.FullPath(), "error", err)
+			c.Header("WWW-Authenticate", `Bearer realm="fetch-assignment"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid credentials"})
+			return
+		}
+		c.Set(principalKey, p)
+		c.Next()
+	}
+}
+
+// PrincipalFrom returns the caller recorded by Middleware.
+func PrincipalFrom(c *gin.Context) (*Principal, bool) {
+	v, ok := c.Get(principalKey)
+	if !ok {
+		return nil, false
+	}
+	p, ok := v.(*Principal)
+	return p, ok
+}
+
+// RestrictedUser returns the Principal's RestrictedTo for the caller recorded
+// by Middleware, or "" if there is none.
+func RestrictedUser(c *gin.Context) string {
+	if p, ok := PrincipalFrom(c); ok {
+		return p.RestrictedTo()
+	}
+	return ""
+}
+
+// Require rejects callers without scope with 403.
+func Require(scope Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := PrincipalFrom(c)
+		if !ok || !p.HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Requires the " + string(scope) + " scope"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSelf rejects callers acting as one user from reaching another
+// user's resources, named by the path parameter param. Admins and API keys,
+// which have no UserID, may reach any user.
+func RequireSelf(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := PrincipalFrom(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Not allowed for this user"})
+			return
+		}
+		if user := p.RestrictedTo(); user != "" && user != c.Param(param) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Not allowed for this user"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireOwner is RequireSelf for actions only the user themselves may take,
+// such as spending their points: it admits admins and callers acting as the
+// user named by param, but not API keys, which act for no user in particular.
+func RequireOwner(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := PrincipalFrom(c)
+		if !ok || !p.HasScope(ScopeAdmin) && (p.UserID == "" || p.UserID != c.Param(param)) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Only the user or an admin may do this"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,56 @@
+package aws
+
+import (
+	awsg "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// SQSAttributeCarrier lets an OpenTelemetry propagator read and write trace
+// context in SQS message attributes.
+type SQSAttributeCarrier map[string]*sqs.MessageAttributeValue
+
+func (c SQSAttributeCarrier) Get(key string) string {
+	if v, ok := c[key]; ok && v.StringValue != nil {
+		return *v.StringValue
+	}
+	return ""
+}
+
+func (c SQSAttributeCarrier) Set(key, value string) {
+	c[key] = &sqs.MessageAttributeValue{
+		DataType:    awsg.String("String"),
+		StringValue: awsg.String(value),
+	}
+}
+
+func (c SQSAttributeCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// snsAttributeCarrier writes trace context into SNS message attributes so
+// subscribers can continue the trace.
+type snsAttributeCarrier map[string]*sns.MessageAttributeValue
+
+func (c snsAttributeCarrier) Get(key string) string {
+	if v, ok := c[key]; ok && v.StringValue != nil {
+		return *v.StringValue
+	}
+	return ""
+}
+
+func (c snsAttributeCarrier) Set(key, value string) {
+	c[key] = stringAttribute(value)
+}
+
+func (c snsAttributeCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
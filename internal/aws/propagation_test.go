@@ -0,0 +1,30 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSQSAttributeCarrier_RoundTrip(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	sent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	prop := propagation.TraceContext{}
+	attrs := SQSAttributeCarrier{}
+	prop.Inject(trace.ContextWithSpanContext(context.Background(), sent), attrs)
+	assert.Equal(t, "String", *attrs["traceparent"].DataType)
+
+	received := trace.SpanContextFromContext(prop.Extract(context.Background(), attrs))
+	assert.Equal(t, sent.TraceID(), received.TraceID())
+	assert.Equal(t, sent.SpanID(), received.SpanID())
+	assert.True(t, received.IsRemote())
+}
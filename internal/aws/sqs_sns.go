@@ -1,89 +1,229 @@
 package aws
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"strconv"
 	"time"
 
 	awsg "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sns"
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/kartikeya55555/fetch-assignment/internal/metrics"
 	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	"github.com/kartikeya55555/fetch-assignment/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// SQSClient interface
+// MaxBatchSize is the most messages SQS accepts in one SendMessageBatch call.
+const MaxBatchSize = 10
+
+// SQSClient interface. Every call honours ctx cancellation and deadlines.
 type SQSClient interface {
-	EnsureQueue() error
-	SendMessage(receipt models.Receipt) error
-	GetMessages() ([]*sqs.Message, error)
-	DeleteMessage(receiptHandle *string) error
+	EnsureQueue(ctx context.Context) error
+	// CheckQueue reads the queue's attributes to confirm SQS is reachable and
+	// the queue still exists.
+	CheckQueue(ctx context.Context) error
+	// QueueDepth returns SQS's approximate message counts by state: "visible"
+	// (waiting), "in_flight" (received, not yet deleted) and "delayed".
+	QueueDepth(ctx context.Context) (map[string]int, error)
+	SendMessage(ctx context.Context, receipt models.Receipt) error
+	// SendMessageBatch enqueues receipts MaxBatchSize at a time and returns
+	// one error per receipt, nil for each one that was queued.
+	SendMessageBatch(ctx context.Context, receipts []models.Receipt) []error
+	GetMessages(ctx context.Context, maxMessages int) ([]*sqs.Message, error)
+	DeleteMessage(ctx context.Context, receiptHandle *string) error
+	ChangeVisibility(ctx context.Context, receiptHandle *string, timeout time.Duration) error
 }
 
-// SNSClient interface
+// SNSClient interface. Every call honours ctx cancellation and deadlines.
 type SNSClient interface {
-	EnsureTopic() error
-	Publish(message string) error
+	EnsureTopic(ctx context.Context) error
+	// CheckTopic reads the topic's attributes to confirm SNS is reachable and
+	// the topic still exists.
+	CheckTopic(ctx context.Context) error
+	Publish(ctx context.Context, event models.ReceiptEvent) error
 }
 
 type sqsClientImpl struct {
-	svc       *sqs.SQS
-	queueName string
-	queueURL  string
+	svc             sqsiface.SQSAPI
+	queueName       string
+	queueURL        string
+	maxReceiveCount int
+	logger          *slog.Logger
 }
 
 type snsClientImpl struct {
 	svc       *sns.SNS
 	topicName string
 	topicARN  string
+	logger    *slog.Logger
 }
 
-// NewSQSClient creates an SQS client
-func NewSQSClient(region, endpoint, queueName string) SQSClient {
+// NewSQSClient creates an SQS client. Messages received more than
+// maxReceiveCount times are moved to the "<queueName>-dlq" dead-letter queue.
+func NewSQSClient(region, endpoint, queueName string, maxReceiveCount int, logger *slog.Logger) SQSClient {
 	sess := session.Must(session.NewSession(&awsg.Config{
 		Region:     awsg.String(region),
 		Endpoint:   awsg.String(endpoint),
 		DisableSSL: awsg.Bool(true),
 	}))
 	svc := sqs.New(sess)
+	svc.Handlers.Complete.PushBackNamed(countErrors("sqs"))
 	return &sqsClientImpl{
-		svc:       svc,
-		queueName: queueName,
+		svc:             svc,
+		queueName:       queueName,
+		maxReceiveCount: maxReceiveCount,
+		logger:          logger,
 	}
 }
 
 // NewSNSClient creates an SNS client
-func NewSNSClient(region, endpoint, topicName string) SNSClient {
+func NewSNSClient(region, endpoint, topicName string, logger *slog.Logger) SNSClient {
 	sess := session.Must(session.NewSession(&awsg.Config{
 		Region:     awsg.String(region),
 		Endpoint:   awsg.String(endpoint),
 		DisableSSL: awsg.Bool(true),
 	}))
 	svc := sns.New(sess)
+	svc.Handlers.Complete.PushBackNamed(countErrors("sns"))
 	return &snsClientImpl{
 		svc:       svc,
 		topicName: topicName,
+		logger:    logger,
 	}
 }
 
-func (c *sqsClientImpl) EnsureQueue() error {
+func (c *sqsClientImpl) EnsureQueue(ctx context.Context) error {
+	dlqURL, err := c.createQueue(ctx, c.queueName+"-dlq")
+	if err != nil {
+		return err
+	}
+	attrs, err := c.svc.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       awsg.String(dlqURL),
+		AttributeNames: []*string{awsg.String(sqs.QueueAttributeNameQueueArn)},
+	})
+	if err != nil {
+		return fmt.Errorf("could not read dead-letter queue ARN: %v", err)
+	}
+
+	queueURL, err := c.createQueue(ctx, c.queueName)
+	if err != nil {
+		return err
+	}
+
+	// Set the redrive policy separately so it also applies to queues created
+	// before the DLQ existed (CreateQueue rejects changed attributes).
+	policy, err := json.Marshal(map[string]string{
+		"deadLetterTargetArn": *attrs.Attributes[sqs.QueueAttributeNameQueueArn],
+		"maxReceiveCount":     strconv.Itoa(c.maxReceiveCount),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.svc.SetQueueAttributesWithContext(ctx, &sqs.SetQueueAttributesInput{
+		QueueUrl: awsg.String(queueURL),
+		Attributes: map[string]*string{
+			sqs.QueueAttributeNameRedrivePolicy: awsg.String(string(policy)),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("could not set redrive policy: %v", err)
+	}
+
+	c.queueURL = queueURL
+	c.logger.InfoContext(ctx, "SQS redrive policy set", "queue", c.queueName, "dlq", c.queueName+"-dlq", "max_receive_count", c.maxReceiveCount)
+	return nil
+}
+
+func (c *sqsClientImpl) CheckQueue(ctx context.Context) error {
+	if c.queueURL == "" {
+		return fmt.Errorf("queue is not initialized")
+	}
+	_, err := c.svc.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       awsg.String(c.queueURL),
+		AttributeNames: []*string{awsg.String(sqs.QueueAttributeNameApproximateNumberOfMessages)},
+	})
+	return err
+}
+
+// queueDepthAttributes maps the queue attributes QueueDepth reads to the
+// states it reports them under.
+var queueDepthAttributes = map[string]string{
+	sqs.QueueAttributeNameApproximateNumberOfMessages:           "visible",
+	sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible: "in_flight",
+	sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed:    "delayed",
+}
+
+func (c *sqsClientImpl) QueueDepth(ctx context.Context) (map[string]int, error) {
+	if c.queueURL == "" {
+		return nil, fmt.Errorf("queue is not initialized")
+	}
+	names := make([]*string, 0, len(queueDepthAttributes))
+	for name := range queueDepthAttributes {
+		names = append(names, awsg.String(name))
+	}
+	out, err := c.svc.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       awsg.String(c.queueURL),
+		AttributeNames: names,
+	})
+	if err != nil {
+		return nil, err
+	}
+	depth := make(map[string]int, len(queueDepthAttributes))
+	for name, state := range queueDepthAttributes {
+		n, err := strconv.Atoi(awsg.StringValue(out.Attributes[name]))
+		if err != nil {
+			return nil, fmt.Errorf("queue attribute %s: %w", name, err)
+		}
+		depth[state] = n
+	}
+	return depth, nil
+}
+
+// createQueue creates (or looks up) a queue, retrying while LocalStack starts.
+func (c *sqsClientImpl) createQueue(ctx context.Context, name string) (string, error) {
 	for i := 1; i <= 5; i++ {
-		out, err := c.svc.CreateQueue(&sqs.CreateQueueInput{
-			QueueName: awsg.String(c.queueName),
+		out, err := c.svc.CreateQueueWithContext(ctx, &sqs.CreateQueueInput{
+			QueueName: awsg.String(name),
 		})
 		if err == nil {
-			c.queueURL = *out.QueueUrl
-			log.Printf("SQS queue ready: %s -> %s\n", c.queueName, c.queueURL)
-			return nil
+			c.logger.InfoContext(ctx, "SQS queue ready", "queue", name, "url", *out.QueueUrl)
+			return *out.QueueUrl, nil
+		}
+		c.logger.WarnContext(ctx, "Failed to create queue", "queue", name, "attempt", i, "error", err)
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(3 * time.Second):
 		}
-		log.Printf("Failed to create queue (attempt %d): %v\n", i, err)
-		time.Sleep(3 * time.Second)
 	}
-	return fmt.Errorf("could not create queue after 5 attempts")
+	return "", fmt.Errorf("could not create queue %s after 5 attempts", name)
 }
 
-func (c *sqsClientImpl) SendMessage(receipt models.Receipt) error {
+// SendMessage enqueues receipt with the caller's trace context in its
+// message attributes, so the worker's spans join the same trace.
+func (c *sqsClientImpl) SendMessage(ctx context.Context, receipt models.Receipt) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, c.queueName+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemAWSSqs,
+			semconv.MessagingDestinationName(c.queueName),
+			attribute.String("receipt.id", receipt.ID),
+		),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	if c.queueURL == "" {
 		return fmt.Errorf("queue is not initialized")
 	}
@@ -91,21 +231,121 @@ func (c *sqsClientImpl) SendMessage(receipt models.Receipt) error {
 	if err != nil {
 		return err
 	}
-	_, err = c.svc.SendMessage(&sqs.SendMessageInput{
-		QueueUrl:    awsg.String(c.queueURL),
-		MessageBody: awsg.String(string(data)),
+	attrs := SQSAttributeCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, attrs)
+	out, err := c.svc.SendMessageWithContext(ctx, &sqs.SendMessageInput{
+		QueueUrl:          awsg.String(c.queueURL),
+		MessageBody:       awsg.String(string(data)),
+		MessageAttributes: attrs,
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(semconv.MessagingMessageID(awsg.StringValue(out.MessageId)))
+	c.logger.DebugContext(ctx, "Message sent", "receipt_id", receipt.ID, "message_id", awsg.StringValue(out.MessageId))
+	return nil
+}
+
+func (c *sqsClientImpl) SendMessageBatch(ctx context.Context, receipts []models.Receipt) []error {
+	errs := make([]error, len(receipts))
+	for start := 0; start < len(receipts); start += MaxBatchSize {
+		end := min(start+MaxBatchSize, len(receipts))
+		c.sendBatch(ctx, receipts[start:end], errs[start:end])
+	}
+	return errs
+}
+
+// sendBatch sends up to MaxBatchSize receipts in one call and records each
+// one's outcome in errs. A failed call fails every receipt it carried; SQS
+// can also reject single entries of a call that succeeded.
+func (c *sqsClientImpl) sendBatch(ctx context.Context, receipts []models.Receipt, errs []error) {
+	ctx, span := tracing.Tracer().Start(ctx, c.queueName+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemAWSSqs,
+			semconv.MessagingDestinationName(c.queueName),
+			semconv.MessagingBatchMessageCount(len(receipts)),
+		),
+	)
+	defer func() {
+		var failed int
+		for _, err := range errs {
+			if err != nil {
+				failed++
+			}
+		}
+		span.SetAttributes(attribute.Int("messaging.batch.failed_count", failed))
+		if failed > 0 {
+			span.SetStatus(codes.Error, fmt.Sprintf("%d of %d messages not sent", failed, len(receipts)))
+		}
+		span.End()
+	}()
+
+	failRest := func(err error) {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = err
+			}
+		}
+	}
+	if c.queueURL == "" {
+		failRest(fmt.Errorf("queue is not initialized"))
+		return
+	}
+
+	// Entry IDs are indexes into receipts, to match up the per-entry results
+	entries := make([]*sqs.SendMessageBatchRequestEntry, 0, len(receipts))
+	for i, r := range receipts {
+		data, err := json.Marshal(r)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		attrs := SQSAttributeCarrier{}
+		otel.GetTextMapPropagator().Inject(ctx, attrs)
+		entries = append(entries, &sqs.SendMessageBatchRequestEntry{
+			Id:                awsg.String(strconv.Itoa(i)),
+			MessageBody:       awsg.String(string(data)),
+			MessageAttributes: attrs,
+		})
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	out, err := c.svc.SendMessageBatchWithContext(ctx, &sqs.SendMessageBatchInput{
+		QueueUrl: awsg.String(c.queueURL),
+		Entries:  entries,
+	})
+	if err != nil {
+		span.RecordError(err)
+		failRest(err)
+		return
+	}
+	for _, f := range out.Failed {
+		i, err := strconv.Atoi(awsg.StringValue(f.Id))
+		if err != nil || i < 0 || i >= len(errs) {
+			continue
+		}
+		errs[i] = fmt.Errorf("%s: %s", awsg.StringValue(f.Code), awsg.StringValue(f.Message))
+	}
+	c.logger.DebugContext(ctx, "Message batch sent", "sent", len(out.Successful), "failed", len(out.Failed))
 }
 
-func (c *sqsClientImpl) GetMessages() ([]*sqs.Message, error) {
+func (c *sqsClientImpl) GetMessages(ctx context.Context, maxMessages int) ([]*sqs.Message, error) {
 	if c.queueURL == "" {
 		return nil, fmt.Errorf("queue is not initialized")
 	}
-	out, err := c.svc.ReceiveMessage(&sqs.ReceiveMessageInput{
+	out, err := c.svc.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
 		QueueUrl:            awsg.String(c.queueURL),
-		MaxNumberOfMessages: awsg.Int64(10),
+		MaxNumberOfMessages: awsg.Int64(int64(maxMessages)),
 		WaitTimeSeconds:     awsg.Int64(5),
+		AttributeNames: []*string{
+			awsg.String(sqs.MessageSystemAttributeNameApproximateReceiveCount),
+			awsg.String(sqs.MessageSystemAttributeNameSentTimestamp),
+		},
+		// Carries the trace context set by SendMessage
+		MessageAttributeNames: []*string{awsg.String(sqs.QueueAttributeNameAll)},
 	})
 	if err != nil {
 		return nil, err
@@ -113,33 +353,102 @@ func (c *sqsClientImpl) GetMessages() ([]*sqs.Message, error) {
 	return out.Messages, nil
 }
 
-func (c *sqsClientImpl) DeleteMessage(receiptHandle *string) error {
-	_, err := c.svc.DeleteMessage(&sqs.DeleteMessageInput{
+func (c *sqsClientImpl) DeleteMessage(ctx context.Context, receiptHandle *string) error {
+	_, err := c.svc.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
 		QueueUrl:      awsg.String(c.queueURL),
 		ReceiptHandle: receiptHandle,
 	})
 	return err
 }
 
-func (s *snsClientImpl) EnsureTopic() error {
-	out, err := s.svc.CreateTopic(&sns.CreateTopicInput{
+// ChangeVisibility hides a received message for timeout before SQS
+// redelivers it, which is how retries are delayed.
+func (c *sqsClientImpl) ChangeVisibility(ctx context.Context, receiptHandle *string, timeout time.Duration) error {
+	_, err := c.svc.ChangeMessageVisibilityWithContext(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          awsg.String(c.queueURL),
+		ReceiptHandle:     receiptHandle,
+		VisibilityTimeout: awsg.Int64(int64(timeout / time.Second)),
+	})
+	return err
+}
+
+func (s *snsClientImpl) EnsureTopic(ctx context.Context) error {
+	out, err := s.svc.CreateTopicWithContext(ctx, &sns.CreateTopicInput{
 		Name: awsg.String(s.topicName),
 	})
 	if err != nil {
 		return err
 	}
 	s.topicARN = *out.TopicArn
-	log.Printf("SNS topic ready: %s -> %s\n", s.topicName, s.topicARN)
+	s.logger.InfoContext(ctx, "SNS topic ready", "topic", s.topicName, "arn", s.topicARN)
 	return nil
 }
 
-func (s *snsClientImpl) Publish(message string) error {
+func (s *snsClientImpl) CheckTopic(ctx context.Context) error {
 	if s.topicARN == "" {
 		return fmt.Errorf("topic is not initialized")
 	}
-	_, err := s.svc.Publish(&sns.PublishInput{
+	_, err := s.svc.GetTopicAttributesWithContext(ctx, &sns.GetTopicAttributesInput{
 		TopicArn: awsg.String(s.topicARN),
-		Message:  awsg.String(message),
 	})
 	return err
 }
+
+// Publish sends event as JSON. eventType and schemaVersion are also set as
+// message attributes so subscriptions can filter on them.
+func (s *snsClientImpl) Publish(ctx context.Context, event models.ReceiptEvent) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, s.topicName+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("aws_sns"),
+			semconv.MessagingDestinationName(s.topicName),
+			attribute.String("receipt.id", event.ReceiptID),
+			attribute.String("receipt.event_type", event.EventType),
+		),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	if s.topicARN == "" {
+		return fmt.Errorf("topic is not initialized")
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	attrs := snsAttributeCarrier{
+		"eventType":     stringAttribute(event.EventType),
+		"schemaVersion": stringAttribute(event.SchemaVersion),
+	}
+	otel.GetTextMapPropagator().Inject(ctx, attrs)
+	_, err = s.svc.PublishWithContext(ctx, &sns.PublishInput{
+		TopicArn:          awsg.String(s.topicARN),
+		Message:           awsg.String(string(data)),
+		MessageAttributes: attrs,
+	})
+	return err
+}
+
+func stringAttribute(value string) *sns.MessageAttributeValue {
+	return &sns.MessageAttributeValue{
+		DataType:    awsg.String("String"),
+		StringValue: awsg.String(value),
+	}
+}
+
+// countErrors is a request handler recording failed calls to service in
+// metrics.AWSErrors. Complete handlers run once per call, after any retries;
+// calls cancelled by ctx, such as long polls cut short by shutdown, don't count.
+func countErrors(service string) request.NamedHandler {
+	return request.NamedHandler{
+		Name: "metrics.countErrors",
+		Fn: func(r *request.Request) {
+			if r.Error == nil {
+				return
+			}
+			if aerr, ok := r.Error.(awserr.Error); ok && aerr.Code() == request.CanceledErrorCode {
+				return
+			}
+			metrics.AWSErrors.WithLabelValues(service, r.Operation.Name).Inc()
+		},
+	}
+}
@@ -0,0 +1,133 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"testing"
+
+	awsg "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSQS records SendMessageBatch calls. It rejects entries whose receipt
+// ID is in reject and fails the whole call numbered failCall (1-based).
+type fakeSQS struct {
+	sqsiface.SQSAPI
+	reject   map[string]bool
+	failCall int
+	calls    [][]*sqs.SendMessageBatchRequestEntry
+	attrs    map[string]*string // returned by GetQueueAttributes
+}
+
+func (f *fakeSQS) SendMessageBatchWithContext(_ awsg.Context, in *sqs.SendMessageBatchInput, _ ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+	f.calls = append(f.calls, in.Entries)
+	if len(f.calls) == f.failCall {
+		return nil, fmt.Errorf("RequestError: send request failed")
+	}
+	out := &sqs.SendMessageBatchOutput{}
+	for _, e := range in.Entries {
+		var r models.Receipt
+		if err := json.Unmarshal([]byte(awsg.StringValue(e.MessageBody)), &r); err != nil {
+			return nil, err
+		}
+		if f.reject[r.ID] {
+			out.Failed = append(out.Failed, &sqs.BatchResultErrorEntry{
+				Id: e.Id, Code: awsg.String("InternalError"), Message: awsg.String("try again"), SenderFault: awsg.Bool(false),
+			})
+			continue
+		}
+		out.Successful = append(out.Successful, &sqs.SendMessageBatchResultEntry{Id: e.Id, MessageId: awsg.String("m-" + r.ID)})
+	}
+	return out, nil
+}
+
+func (f *fakeSQS) GetQueueAttributesWithContext(_ awsg.Context, in *sqs.GetQueueAttributesInput, _ ...request.Option) (*sqs.GetQueueAttributesOutput, error) {
+	out := &sqs.GetQueueAttributesOutput{Attributes: map[string]*string{}}
+	for _, name := range in.AttributeNames {
+		if v, ok := f.attrs[*name]; ok {
+			out.Attributes[*name] = v
+		}
+	}
+	return out, nil
+}
+
+func newFakeSQSClient(f *fakeSQS) *sqsClientImpl {
+	return &sqsClientImpl{
+		svc:       f,
+		queueName: "receipt-queue",
+		queueURL:  "http://localhost:4566/000000000000/receipt-queue",
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+func receipts(n int) []models.Receipt {
+	rs := make([]models.Receipt, n)
+	for i := range rs {
+		rs[i] = models.Receipt{ID: "r" + strconv.Itoa(i), Retailer: "Target"}
+	}
+	return rs
+}
+
+func TestSendMessageBatch_ChunksByMaxBatchSize(t *testing.T) {
+	f := &fakeSQS{}
+	errs := newFakeSQSClient(f).SendMessageBatch(context.Background(), receipts(23))
+
+	require.Len(t, errs, 23)
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	require.Len(t, f.calls, 3)
+	assert.Len(t, f.calls[0], 10)
+	assert.Len(t, f.calls[1], 10)
+	assert.Len(t, f.calls[2], 3)
+	// Entry IDs restart in every call, as indexes into its chunk
+	assert.Equal(t, "0", awsg.StringValue(f.calls[2][0].Id))
+	assert.Equal(t, "2", awsg.StringValue(f.calls[2][2].Id))
+}
+
+func TestSendMessageBatch_MapsFailedEntriesToReceipts(t *testing.T) {
+	f := &fakeSQS{reject: map[string]bool{"r3": true, "r14": true}}
+	errs := newFakeSQSClient(f).SendMessageBatch(context.Background(), receipts(15))
+
+	for i, err := range errs {
+		if i == 3 || i == 14 {
+			assert.ErrorContains(t, err, "InternalError: try again", "receipt %d", i)
+		} else {
+			assert.NoError(t, err, "receipt %d", i)
+		}
+	}
+}
+
+func TestSendMessageBatch_FailedCallFailsItsChunkOnly(t *testing.T) {
+	f := &fakeSQS{failCall: 2}
+	errs := newFakeSQSClient(f).SendMessageBatch(context.Background(), receipts(25))
+
+	for i, err := range errs {
+		if i >= 10 && i < 20 {
+			assert.ErrorContains(t, err, "send request failed", "receipt %d", i)
+		} else {
+			assert.NoError(t, err, "receipt %d", i)
+		}
+	}
+}
+
+func TestQueueDepth(t *testing.T) {
+	f := &fakeSQS{attrs: map[string]*string{
+		sqs.QueueAttributeNameApproximateNumberOfMessages:           awsg.String("42"),
+		sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible: awsg.String("7"),
+		sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed:    awsg.String("0"),
+	}}
+	depth, err := newFakeSQSClient(f).QueueDepth(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"visible": 42, "in_flight": 7, "delayed": 0}, depth)
+}
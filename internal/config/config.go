@@ -1,28 +1,84 @@
 package config
 
 import (
+	"log/slog"
 	"os"
+	"strconv"
+	"time"
+)
+
+// Service roles selectable via SERVICE_TYPE.
+const (
+	ServiceTypeAPI    = "api"
+	ServiceTypeWorker = "worker"
+	ServiceTypeAll    = "all"
 )
 
 // Config holds all configuration values for the app
 type Config struct {
-	ServiceType  string // "api" or "worker"
-	Port         string // defaults to "8080"
-	AWSRegion    string
-	AWSEndpoint  string
-	SQSQueueName string
-	SNSTopicName string
+	ServiceType       string // "api", "worker" or "all" (both in one process)
+	Port              string // defaults to "8080"
+	AWSRegion         string
+	AWSEndpoint       string
+	SQSQueueName      string
+	SNSTopicName      string
+	MaxReceiveCount   int           // deliveries before SQS moves a message to the DLQ
+	WorkerConcurrency int           // number of concurrent SQS consumers
+	WorkerBatchSize   int           // messages per receive (1-10)
+	WorkerIdleBackoff time.Duration // pause after an empty or failed poll
+	ShutdownTimeout   time.Duration // how long to drain HTTP requests and in-flight messages
+	PointsRulesFile   string        // optional JSON file enabling/disabling/reweighting points rules
+	IdempotencyWindow time.Duration // how long an Idempotency-Key returns the original receipt
+	StoreType         string        // "memory" or "sqlite"
+	StorePath         string        // database file used by the sqlite store
+	AuthDisabled      bool          // let every request through as an admin; only for local development
+	APIKeysFile       string        // optional JSON file of hashed API keys and their scopes
+	JWKSFile          string        // optional JWKS file of keys that verify bearer tokens
+	JWTIssuer         string        // required "iss" of bearer tokens, if set
+	JWTAudience       string        // required "aud" of bearer tokens, if set
+	RateLimitPerMin   int           // receipt submissions per minute per client; 0 disables limiting
+	RateLimitBurst    int           // submissions a client may make at once before the rate applies
+	BatchMaxReceipts  int           // most receipts accepted by one POST /receipts/batch
+	BatchMaxBytes     int64         // largest POST /receipts/batch body accepted
+	TracingExporter   string        // "none", "stdout" or "otlp" (endpoint from OTEL_EXPORTER_OTLP_ENDPOINT)
+	LogLevel          string        // "debug", "info", "warn" or "error"
+	MetricsToken      string        // bearer token /metrics requires, if set
+	HealthTimeout     time.Duration // how long each /livez and /readyz dependency check may take
+	HeartbeatTimeout  time.Duration // how long a worker consumer may go without polling before /livez fails
 }
 
 // LoadConfig loads environment variables into a Config struct.
 func LoadConfig() *Config {
 	return &Config{
-		ServiceType:  getEnv("SERVICE_TYPE", "api"),
-		Port:         getEnv("PORT", "8080"),
-		AWSRegion:    getEnv("AWS_REGION", "us-east-1"),
-		AWSEndpoint:  getEnv("AWS_ENDPOINT", "http://localhost:4566"),
-		SQSQueueName: getEnv("SQS_QUEUE_NAME", "receipt-queue"),
-		SNSTopicName: getEnv("SNS_TOPIC_NAME", "receipt-topic"),
+		ServiceType:       getEnv("SERVICE_TYPE", ServiceTypeAll),
+		Port:              getEnv("PORT", "8080"),
+		AWSRegion:         getEnv("AWS_REGION", "us-east-1"),
+		AWSEndpoint:       getEnv("AWS_ENDPOINT", "http://localhost:4566"),
+		SQSQueueName:      getEnv("SQS_QUEUE_NAME", "receipt-queue"),
+		SNSTopicName:      getEnv("SNS_TOPIC_NAME", "receipt-topic"),
+		MaxReceiveCount:   getEnvInt("SQS_MAX_RECEIVE_COUNT", 5),
+		WorkerConcurrency: getEnvInt("WORKER_CONCURRENCY", 4),
+		WorkerBatchSize:   getEnvInt("WORKER_BATCH_SIZE", 10),
+		WorkerIdleBackoff: getEnvDuration("WORKER_IDLE_BACKOFF", time.Second),
+		ShutdownTimeout:   getEnvDuration("SHUTDOWN_TIMEOUT", 25*time.Second),
+		PointsRulesFile:   getEnv("POINTS_RULES_FILE", ""),
+		IdempotencyWindow: getEnvDuration("IDEMPOTENCY_WINDOW", 24*time.Hour),
+		StoreType:         getEnv("STORE_TYPE", "memory"),
+		StorePath:         getEnv("STORE_PATH", "receipts.db"),
+		AuthDisabled:      getEnvBool("AUTH_DISABLED", false),
+		APIKeysFile:       getEnv("API_KEYS_FILE", ""),
+		JWKSFile:          getEnv("JWKS_FILE", ""),
+		JWTIssuer:         getEnv("JWT_ISSUER", ""),
+		JWTAudience:       getEnv("JWT_AUDIENCE", ""),
+		RateLimitPerMin:   getEnvInt("RATE_LIMIT_PER_MINUTE", 60),
+		RateLimitBurst:    getEnvInt("RATE_LIMIT_BURST", 20),
+		BatchMaxReceipts:  getEnvInt("BATCH_MAX_RECEIPTS", 5000),
+		BatchMaxBytes:     int64(getEnvInt("BATCH_MAX_BYTES", 10<<20)),
+		TracingExporter:   getEnv("TRACING_EXPORTER", "none"),
+		LogLevel:          getEnv("LOG_LEVEL", "info"),
+		MetricsToken:      getEnv("METRICS_TOKEN", ""),
+		HealthTimeout:     getEnvDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second),
+		HeartbeatTimeout:  getEnvDuration("WORKER_HEARTBEAT_TIMEOUT", 30*time.Second),
 	}
 }
 
@@ -34,3 +90,45 @@ func getEnv(key, defaultValue string) string {
 	}
 	return val
 }
+
+// getEnvInt is getEnv for integer values; malformed values fall back to the default
+func getEnvInt(key string, defaultValue int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		slog.Warn("Invalid integer setting, using default", "key", key, "value", val, "default", defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// getEnvBool is getEnv for booleans such as "true" or "0"
+func getEnvBool(key string, defaultValue bool) bool {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		slog.Warn("Invalid boolean setting, using default", "key", key, "value", val, "default", defaultValue)
+		return defaultValue
+	}
+	return b
+}
+
+// getEnvDuration is getEnv for durations such as "500ms" or "2s"
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		slog.Warn("Invalid duration setting, using default", "key", key, "value", val, "default", defaultValue)
+		return defaultValue
+	}
+	return d
+}
@@ -3,8 +3,24 @@ package errors
 import "errors"
 
 var (
-	ErrNotValidTimeFormat  = errors.New("time of purchase is not valid")
-	ErrReceiptNotExist     = errors.New("receiptId doesn't exist")
-	ErrNotValidTotalFormat = errors.New("total format is not valid")
-	ErrNotValidDateFormat  = errors.New("date format is not valid")
+	ErrNotValidTimeFormat   = errors.New("time of purchase is not valid")
+	ErrReceiptNotExist      = errors.New("receiptId doesn't exist")
+	ErrNotValidTotalFormat  = errors.New("total format is not valid")
+	ErrNotValidDateFormat   = errors.New("date format is not valid")
+	ErrNotValidPriceFormat  = errors.New("item price format is not valid")
+	ErrItemsTotalMismatch   = errors.New("item prices do not add up to total")
+	ErrInvalidQuery         = errors.New("invalid receipt query")
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different receipt")
+	ErrInsufficientPoints   = errors.New("not enough points for this redemption")
+	ErrInvalidRedemption    = errors.New("redemption must be for a positive number of points")
+	ErrUnauthenticated      = errors.New("missing or invalid credentials")
+	ErrBatchTooLarge        = errors.New("batch has too many receipts")
+
+	// ErrInvalidStatusTransition means the receipt was not in the expected
+	// status, e.g. a redelivered message for an already finished receipt.
+	ErrInvalidStatusTransition = errors.New("invalid receipt status transition")
+
+	// Permanent processing failures: retrying the same message cannot succeed.
+	ErrReceiptValidation = errors.New("receipt validation failed")
+	ErrMalformedMessage  = errors.New("malformed queue message")
 )
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kartikeya55555/fetch-assignment/internal/auth"
+	"github.com/kartikeya55555/fetch-assignment/internal/aws"
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	"github.com/kartikeya55555/fetch-assignment/internal/receipt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixedAuth authenticates every request as its principal.
+type fixedAuth struct{ principal *auth.Principal }
+
+func (a fixedAuth) Authenticate(*http.Request) (*auth.Principal, error) {
+	return a.principal, nil
+}
+
+// newTestRouter serves h's routes behind auth.Middleware, as principal.
+func newTestRouter(h ReceiptHandler, principal *auth.Principal) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := r.Group("/", auth.Middleware(fixedAuth{principal}))
+	api.POST("/receipts/process", h.QueueReceipt)
+	api.POST("/receipts/batch", h.QueueReceiptBatch)
+	api.GET("/receipts", h.ListReceipts)
+	api.GET("/receipts/:id", h.GetReceipt)
+	api.GET("/receipts/:id/points", h.GetReceiptPoints)
+	api.POST("/receipts/:id/flag", h.FlagReceipt)
+	api.POST("/users/:id/redemptions", h.RedeemPoints)
+	return r
+}
+
+func newTestHandler(service receipt.ReceiptService, sqs aws.SQSClient) ReceiptHandler {
+	return NewReceiptHandler(service, sqs, slog.New(slog.NewTextHandler(io.Discard, nil)), 100, 1<<20)
+}
+
+// seededService holds receipt "a1" of alice and "b1" of bob.
+func seededService(t *testing.T) receipt.ReceiptService {
+	t.Helper()
+	service := receipt.NewReceiptService(receipt.NewInMemoryStore(), receipt.NewDefaultPointsCalculator())
+	for id, user := range map[string]string{"a1": "alice", "b1": "bob"} {
+		require.NoError(t, service.StorePendingReceipt(context.Background(), &models.Receipt{
+			ID: id, UserID: user, Retailer: "Target", PurchaseDate: "2022-01-01",
+		}))
+	}
+	return service
+}
+
+func get(r http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestListReceipts_TokenSeesOnlyOwnReceipts(t *testing.T) {
+	h := newTestHandler(seededService(t), nil)
+
+	listIDs := func(p *auth.Principal) []string {
+		w := get(newTestRouter(h, p), "/receipts")
+		require.Equal(t, http.StatusOK, w.Code)
+		var page receipt.ReceiptPage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		var ids []string
+		for _, r := range page.Receipts {
+			ids = append(ids, r.ID)
+		}
+		return ids
+	}
+
+	alice := &auth.Principal{ID: "alice", UserID: "alice", Scopes: []auth.Scope{auth.ScopeRead}}
+	assert.Equal(t, []string{"a1"}, listIDs(alice))
+
+	admin := &auth.Principal{ID: "ops", UserID: "ops", Scopes: []auth.Scope{auth.ScopeAdmin}}
+	assert.ElementsMatch(t, []string{"a1", "b1"}, listIDs(admin))
+
+	apiKey := &auth.Principal{ID: "checkout", Scopes: []auth.Scope{auth.ScopeRead}}
+	assert.ElementsMatch(t, []string{"a1", "b1"}, listIDs(apiKey))
+}
+
+func TestGetReceipt_HidesOtherUsersReceipts(t *testing.T) {
+	h := newTestHandler(seededService(t), nil)
+	alice := newTestRouter(h, &auth.Principal{ID: "alice", UserID: "alice", Scopes: []auth.Scope{auth.ScopeRead}})
+
+	assert.Equal(t, http.StatusOK, get(alice, "/receipts/a1").Code)
+	assert.Equal(t, http.StatusNotFound, get(alice, "/receipts/b1").Code)
+	assert.Equal(t, http.StatusNotFound, get(alice, "/receipts/b1/points").Code)
+
+	apiKey := newTestRouter(h, &auth.Principal{ID: "checkout", Scopes: []auth.Scope{auth.ScopeRead}})
+	assert.Equal(t, http.StatusOK, get(apiKey, "/receipts/b1").Code)
+}
+
+func TestListReceipts_RejectsUnknownStatus(t *testing.T) {
+	r := newTestRouter(newTestHandler(seededService(t), nil), &auth.Principal{ID: "ops", Scopes: []auth.Scope{auth.ScopeAdmin}})
+
+	assert.Equal(t, http.StatusOK, get(r, "/receipts?status=pending").Code)
+	w := get(r, "/receipts?status=COMPLETE")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `unknown status \"COMPLETE\"`)
+}
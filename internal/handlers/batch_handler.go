@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kartikeya55555/fetch-assignment/internal/errors"
+	"github.com/kartikeya55555/fetch-assignment/internal/metrics"
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	"github.com/kartikeya55555/fetch-assignment/internal/ratelimit"
+)
+
+// Outcomes of each entry of a batch, also used as metrics.BatchReceipts labels.
+const (
+	batchQueued  = "queued"
+	batchInvalid = "invalid"
+	batchFailed  = "failed"
+)
+
+// batchResult reports what happened to one entry of a batch; Index is its
+// position in the request. ID is set for every receipt that was stored,
+// including those that failed to queue and are now FAILED.
+type batchResult struct {
+	Index            int                 `json:"index"`
+	Status           string              `json:"status"`
+	ID               string              `json:"id,omitempty"`
+	Error            string              `json:"error,omitempty"`
+	ValidationErrors []models.FieldError `json:"validationErrors,omitempty"`
+}
+
+// POST /receipts/batch takes a JSON array of receipts or one receipt per line
+// (NDJSON). Each entry is validated, stored and queued on its own, so one bad
+// receipt doesn't sink the rest: the response is 202 if every receipt was
+// queued and 207 with per-entry results otherwise. Every entry counts
+// against the caller's rate limit.
+//
+// Batches can't be replayed, so an Idempotency-Key is refused rather than
+// ignored: a client relying on it would resubmit every receipt on retry.
+func (h *receiptHandler) QueueReceiptBatch(c *gin.Context) {
+	ctx := c.Request.Context()
+	if c.GetHeader("Idempotency-Key") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is not supported for batches; submit through POST /receipts/process to retry safely"})
+		return
+	}
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, h.maxBytes)
+	entries, err := decodeBatch(body, h.maxBatch)
+	var tooBig *http.MaxBytesError
+	if stderrors.As(err, &tooBig) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("batch body exceeds %d bytes", tooBig.Limit)})
+		return
+	}
+	if stderrors.Is(err, errors.ErrBatchTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid batch: " + err.Error()})
+		return
+	}
+	// The rate limiter already charged the request itself
+	if !ratelimit.ChargeN(c, len(entries)-1) {
+		return
+	}
+
+	results := make([]batchResult, len(entries))
+	userID := submitter(c)
+	var pending []models.Receipt
+	var pendingIdx []int // index in entries of each pending receipt
+	for i, raw := range entries {
+		results[i] = batchResult{Index: i, Status: batchInvalid}
+
+		var r models.Receipt
+		if err := json.Unmarshal(raw, &r); err != nil {
+			results[i].Error = "Invalid input: " + err.Error()
+			continue
+		}
+		if issues := h.service.ValidateReceipt(&r); len(issues) > 0 {
+			results[i].Error = "Invalid receipt"
+			results[i].ValidationErrors = issues
+			continue
+		}
+
+		r.ID = uuid.NewString()
+		r.UserID = userID
+		r.Status = models.StatusPending
+		if err := h.service.StorePendingReceipt(ctx, &r); err != nil {
+			h.logger.ErrorContext(ctx, "Failed to store pending receipt", "receipt_id", r.ID, "error", err)
+			results[i].Status = batchFailed
+			results[i].Error = "Failed to store pending receipt"
+			continue
+		}
+		pending = append(pending, r)
+		pendingIdx = append(pendingIdx, i)
+	}
+
+	for j, err := range h.sqsClient.SendMessageBatch(ctx, pending) {
+		i := pendingIdx[j]
+		results[i].ID = pending[j].ID
+		if err != nil {
+			h.logger.ErrorContext(ctx, "Failed to enqueue receipt", "receipt_id", pending[j].ID, "error", err)
+			h.failUnqueued(c, &pending[j])
+			results[i].Status = batchFailed
+			results[i].Error = "Failed to enqueue receipt: " + err.Error()
+			continue
+		}
+		results[i].Status = batchQueued
+	}
+
+	counts := map[string]int{batchQueued: 0, batchInvalid: 0, batchFailed: 0}
+	for _, res := range results {
+		counts[res.Status]++
+	}
+	for result, n := range counts {
+		metrics.BatchReceipts.WithLabelValues(result).Add(float64(n))
+	}
+	h.logger.InfoContext(ctx, "Receipt batch processed", "user_id", userID,
+		"queued", counts[batchQueued], "invalid", counts[batchInvalid], "failed", counts[batchFailed])
+
+	status := http.StatusAccepted
+	if counts[batchQueued] < len(results) {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, gin.H{
+		"queued":  counts[batchQueued],
+		"invalid": counts[batchInvalid],
+		"failed":  counts[batchFailed],
+		"results": results,
+	})
+}
+
+// decodeBatch splits body into its raw receipts: the elements of a JSON
+// array, or the values of an NDJSON stream. It fails on malformed JSON, on
+// an empty batch and, with errors.ErrBatchTooLarge, on more than limit entries
+// without reading the rest of the body.
+func decodeBatch(body io.Reader, limit int) ([]json.RawMessage, error) {
+	br := bufio.NewReader(body)
+	first, err := peekNonSpace(br)
+	if err == io.EOF {
+		return nil, fmt.Errorf("batch is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(br)
+	isArray := first == '['
+	if isArray {
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	var entries []json.RawMessage
+	for {
+		if isArray && !dec.More() {
+			break
+		}
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if !isArray && err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", len(entries), err)
+		}
+		if len(entries) == limit {
+			return nil, fmt.Errorf("%w: at most %d allowed", errors.ErrBatchTooLarge, limit)
+		}
+		entries = append(entries, raw)
+	}
+	if isArray {
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("batch is empty")
+	}
+	return entries, nil
+}
+
+// peekNonSpace skips leading whitespace and returns the next byte without
+// consuming it.
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, br.UnreadByte()
+	}
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kartikeya55555/fetch-assignment/internal/auth"
+	"github.com/kartikeya55555/fetch-assignment/internal/aws"
+	"github.com/kartikeya55555/fetch-assignment/internal/errors"
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	"github.com/kartikeya55555/fetch-assignment/internal/ratelimit"
+	"github.com/kartikeya55555/fetch-assignment/internal/receipt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeBatch_Array(t *testing.T) {
+	entries, err := decodeBatch(strings.NewReader(` [{"retailer":"A"}, {"retailer":"B"}, 7] `), 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.JSONEq(t, `{"retailer":"B"}`, string(entries[1]))
+	// Not a receipt, but still well-formed JSON: rejected per entry later
+	assert.Equal(t, "7", string(entries[2]))
+}
+
+func TestDecodeBatch_NDJSON(t *testing.T) {
+	entries, err := decodeBatch(strings.NewReader("{\"retailer\":\"A\"}\n\n{\"retailer\":\"B\"}\n"), 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.JSONEq(t, `{"retailer":"A"}`, string(entries[0]))
+}
+
+func TestDecodeBatch_Errors(t *testing.T) {
+	for name, body := range map[string]string{
+		"empty":            "  \n",
+		"empty array":      "[]",
+		"malformed entry":  `[{"retailer":"A"}, {"retailer":]`,
+		"unterminated":     `[{"retailer":"A"}`,
+		"malformed ndjson": "{\"retailer\":\"A\"}\n{oops}\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := decodeBatch(strings.NewReader(body), 10)
+			assert.Error(t, err)
+			assert.NotErrorIs(t, err, errors.ErrBatchTooLarge)
+		})
+	}
+}
+
+func TestDecodeBatch_TooLarge(t *testing.T) {
+	_, err := decodeBatch(strings.NewReader(`[{}, {}, {}]`), 2)
+	assert.ErrorIs(t, err, errors.ErrBatchTooLarge)
+
+	entries, err := decodeBatch(strings.NewReader("{}\n{}\n"), 2)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestQueueReceiptBatch_Limits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewReceiptHandler(nil, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), 100, 64)
+	r := gin.New()
+	r.POST("/receipts/batch", ratelimit.Middleware(ratelimit.NewTokenBucket(1, 2)), h.QueueReceiptBatch)
+
+	send := func(body string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/receipts/batch", strings.NewReader(body)))
+		return w.Code
+	}
+
+	// Past maxBytes the body is cut off instead of read to the end
+	assert.Equal(t, http.StatusRequestEntityTooLarge, send("["+strings.Repeat(`{"retailer":"Target"},`, 10)+"{}]"))
+	// Three receipts cost three submissions, more than the one left
+	assert.Equal(t, http.StatusTooManyRequests, send("{}\n{}\n{}\n"))
+}
+
+// fakeSQS queues every receipt handed to SendMessageBatch except those from
+// a retailer in reject.
+type fakeSQS struct {
+	aws.SQSClient
+	reject map[string]bool
+	calls  [][]models.Receipt
+}
+
+func (f *fakeSQS) SendMessageBatch(_ context.Context, receipts []models.Receipt) []error {
+	f.calls = append(f.calls, receipts)
+	errs := make([]error, len(receipts))
+	for i, r := range receipts {
+		if f.reject[r.Retailer] {
+			errs[i] = fmt.Errorf("InternalError: try again")
+		}
+	}
+	return errs
+}
+
+func (f *fakeSQS) SendMessage(ctx context.Context, r models.Receipt) error {
+	return f.SendMessageBatch(ctx, []models.Receipt{r})[0]
+}
+
+// disconnectingSQS fails every enqueue the way a client that disconnects
+// mid-request does: the request context is cancelled first.
+type disconnectingSQS struct {
+	aws.SQSClient
+	cancel context.CancelFunc
+}
+
+func (f *disconnectingSQS) SendMessage(ctx context.Context, _ models.Receipt) error {
+	f.cancel()
+	return ctx.Err()
+}
+
+func (f *disconnectingSQS) SendMessageBatch(ctx context.Context, receipts []models.Receipt) []error {
+	f.cancel()
+	errs := make([]error, len(receipts))
+	for i := range errs {
+		errs[i] = ctx.Err()
+	}
+	return errs
+}
+
+// sqliteService is a ReceiptService on a fresh SQLite store, which, unlike
+// the in-memory one, refuses to run on a cancelled context.
+func sqliteService(t *testing.T) receipt.ReceiptService {
+	t.Helper()
+	store, err := receipt.NewSQLiteStore(filepath.Join(t.TempDir(), "receipts.db"))
+	require.NoError(t, err)
+	return receipt.NewReceiptService(store, receipt.NewDefaultPointsCalculator())
+}
+
+// batchReceipt is a valid receipt from retailer.
+func batchReceipt(retailer string) string {
+	return fmt.Sprintf(`{"retailer":%q,"purchaseDate":"2022-01-01","purchaseTime":"13:01",`+
+		`"items":[{"shortDescription":"Mountain Dew 12PK","price":"6.49"}],"total":"6.49"}`, retailer)
+}
+
+type batchResponse struct {
+	Queued, Invalid, Failed int
+	Results                 []batchResult
+}
+
+func postBatch(t *testing.T, r http.Handler, body string) (int, batchResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/receipts/batch", strings.NewReader(body))
+	req.Header.Set(UserIDHeader, "alice")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp batchResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), w.Body.String())
+	return w.Code, resp
+}
+
+var apiKeyPrincipal = &auth.Principal{ID: "checkout", Scopes: []auth.Scope{auth.ScopeSubmit, auth.ScopeRead}}
+
+func TestQueueReceiptBatch_AllQueued(t *testing.T) {
+	service := receipt.NewReceiptService(receipt.NewInMemoryStore(), receipt.NewDefaultPointsCalculator())
+	sqs := &fakeSQS{}
+	r := newTestRouter(newTestHandler(service, sqs), apiKeyPrincipal)
+
+	code, resp := postBatch(t, r, "["+batchReceipt("Target")+","+batchReceipt("Walmart")+"]")
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, 2, resp.Queued)
+	require.Len(t, sqs.calls, 1)
+	require.Len(t, sqs.calls[0], 2)
+
+	for i, res := range resp.Results {
+		assert.Equal(t, i, res.Index)
+		assert.Equal(t, batchQueued, res.Status)
+		stored, err := service.GetReceipt(context.Background(), res.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.StatusPending, stored.Status)
+		// API keys submit for the user they name
+		assert.Equal(t, "alice", stored.UserID)
+	}
+}
+
+func TestQueueReceiptBatch_TokenSubmitsForItsSubject(t *testing.T) {
+	service := receipt.NewReceiptService(receipt.NewInMemoryStore(), receipt.NewDefaultPointsCalculator())
+	bob := &auth.Principal{ID: "bob", UserID: "bob", Scopes: []auth.Scope{auth.ScopeSubmit}}
+	r := newTestRouter(newTestHandler(service, &fakeSQS{}), bob)
+
+	// The X-User-ID header postBatch sets is ignored for bearer tokens
+	_, resp := postBatch(t, r, batchReceipt("Target"))
+	stored, err := service.GetReceipt(context.Background(), resp.Results[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "bob", stored.UserID)
+}
+
+func TestQueueReceiptBatch_PartialFailure(t *testing.T) {
+	service := receipt.NewReceiptService(receipt.NewInMemoryStore(), receipt.NewDefaultPointsCalculator())
+	sqs := &fakeSQS{reject: map[string]bool{"Rejected": true}}
+	r := newTestRouter(newTestHandler(service, sqs), apiKeyPrincipal)
+
+	// 25 entries, more than one SendMessageBatch call holds: every fifth one
+	// is invalid and every seventh valid one is rejected by SQS, so positions
+	// in the request and in the pending slice diverge
+	var lines []string
+	want := make([]string, 25)
+	valid := 0
+	for i := range want {
+		switch {
+		case i%5 == 4:
+			lines = append(lines, `{"retailer":"Target"}`)
+			want[i] = batchInvalid
+		case valid%7 == 6:
+			lines = append(lines, batchReceipt("Rejected"))
+			want[i] = batchFailed
+			valid++
+		default:
+			lines = append(lines, batchReceipt(fmt.Sprintf("Store %d", i)))
+			want[i] = batchQueued
+			valid++
+		}
+	}
+
+	code, resp := postBatch(t, r, strings.Join(lines, "\n"))
+	assert.Equal(t, http.StatusMultiStatus, code)
+	assert.Equal(t, 18, resp.Queued)
+	assert.Equal(t, 5, resp.Invalid)
+	assert.Equal(t, 2, resp.Failed)
+	require.Len(t, sqs.calls, 1)
+	assert.Len(t, sqs.calls[0], 20)
+
+	require.Len(t, resp.Results, 25)
+	for i, res := range resp.Results {
+		assert.Equal(t, i, res.Index)
+		assert.Equal(t, want[i], res.Status, "entry %d", i)
+		switch res.Status {
+		case batchInvalid:
+			assert.Empty(t, res.ID)
+			assert.NotEmpty(t, res.ValidationErrors)
+		case batchQueued:
+			stored, err := service.GetReceipt(context.Background(), res.ID)
+			require.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("Store %d", i), stored.Retailer)
+		case batchFailed:
+			// Returned and marked FAILED instead of stranded as PENDING
+			assert.Contains(t, res.Error, "InternalError")
+			stored, err := service.GetReceipt(context.Background(), res.ID)
+			require.NoError(t, err)
+			assert.Equal(t, models.StatusFailed, stored.Status)
+			assert.Equal(t, "Rejected", stored.Retailer)
+		}
+	}
+}
+
+func TestQueueReceipt_FailsUnqueuedReceiptAfterDisconnect(t *testing.T) {
+	for _, path := range []string{"/receipts/process", "/receipts/batch"} {
+		t.Run(path, func(t *testing.T) {
+			service := sqliteService(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			r := newTestRouter(newTestHandler(service, &disconnectingSQS{cancel: cancel}), apiKeyPrincipal)
+
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(batchReceipt("Target"))).WithContext(ctx)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			page, err := service.ListReceipts(context.Background(), receipt.ReceiptQuery{})
+			require.NoError(t, err)
+			require.Len(t, page.Receipts, 1, w.Body.String())
+			assert.Equal(t, models.StatusFailed, page.Receipts[0].Status)
+		})
+	}
+}
+
+func TestQueueReceipt_RetryAfterDisconnectIsNotReplayed(t *testing.T) {
+	service := sqliteService(t)
+	submit := func(ctx context.Context, sqs aws.SQSClient) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(batchReceipt("Target"))).WithContext(ctx)
+		req.Header.Set("Idempotency-Key", "k1")
+		w := httptest.NewRecorder()
+		newTestRouter(newTestHandler(service, sqs), apiKeyPrincipal).ServeHTTP(w, req)
+		return w
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := submit(ctx, &disconnectingSQS{cancel: cancel})
+	require.Equal(t, http.StatusInternalServerError, first.Code)
+
+	// The key was released, so the retry is queued instead of being answered
+	// with the ID of the receipt that was never enqueued
+	retry := submit(context.Background(), &fakeSQS{})
+	require.Equal(t, http.StatusAccepted, retry.Code, retry.Body.String())
+	assert.Empty(t, retry.Header().Get("Idempotent-Replayed"))
+	var resp struct{ ID string }
+	require.NoError(t, json.Unmarshal(retry.Body.Bytes(), &resp))
+	stored, err := service.GetReceipt(context.Background(), resp.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusPending, stored.Status)
+}
+
+func TestQueueReceiptBatch_RejectsIdempotencyKey(t *testing.T) {
+	service := receipt.NewReceiptService(receipt.NewInMemoryStore(), receipt.NewDefaultPointsCalculator())
+	sqs := &fakeSQS{}
+	r := newTestRouter(newTestHandler(service, sqs), apiKeyPrincipal)
+
+	req := httptest.NewRequest(http.MethodPost, "/receipts/batch", strings.NewReader(batchReceipt("Target")))
+	req.Header.Set("Idempotency-Key", "upload-1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Idempotency-Key")
+	assert.Empty(t, sqs.calls)
+}
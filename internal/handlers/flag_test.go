@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kartikeya55555/fetch-assignment/internal/auth"
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	"github.com/kartikeya55555/fetch-assignment/internal/receipt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlagReceipt_ReversesCredit(t *testing.T) {
+	ctx := context.Background()
+	service := receipt.NewReceiptService(receipt.NewInMemoryStore(), receipt.NewDefaultPointsCalculator())
+	r := &models.Receipt{
+		ID: "r1", UserID: "alice", Retailer: "Target", PurchaseDate: "2022-01-01", PurchaseTime: "13:01",
+		Items: []models.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}}, Total: "6.49",
+	}
+	require.NoError(t, service.StorePendingReceipt(ctx, r))
+	_, err := service.ProcessReceipt(ctx, r)
+	require.NoError(t, err)
+	credited, err := service.GetUserPoints(ctx, "alice")
+	require.NoError(t, err)
+	require.Positive(t, credited)
+
+	admin := newTestRouter(newTestHandler(service, nil), &auth.Principal{ID: "ops", Scopes: []auth.Scope{auth.ScopeAdmin}})
+	flag := func(id, body string) int {
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/receipts/"+id+"/flag", strings.NewReader(body)))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, flag("r1", `{}`))
+	assert.Equal(t, http.StatusNotFound, flag("missing", `{"reason":"refunded"}`))
+	assert.Equal(t, http.StatusOK, flag("r1", `{"reason":"refunded"}`))
+	assert.Equal(t, http.StatusConflict, flag("r1", `{"reason":"refunded"}`))
+
+	stored, err := service.GetReceipt(ctx, "r1")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusFlagged, stored.Status)
+	assert.Equal(t, "refunded", stored.FlagReason)
+	entries, err := service.GetUserLedger(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, models.LedgerReversal, entries[1].Kind)
+	assert.Equal(t, -credited, entries[1].Points)
+}
@@ -1,28 +1,58 @@
 package handlers
 
 import (
-	"log"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/kartikeya55555/fetch-assignment/internal/auth"
 	"github.com/kartikeya55555/fetch-assignment/internal/aws"
+	"github.com/kartikeya55555/fetch-assignment/internal/errors"
 	"github.com/kartikeya55555/fetch-assignment/internal/models"
 	"github.com/kartikeya55555/fetch-assignment/internal/receipt"
 )
 
 type ReceiptHandler interface {
 	QueueReceipt(c *gin.Context)
+	QueueReceiptBatch(c *gin.Context)
 	GetReceiptPoints(c *gin.Context)
+	GetReceiptBreakdown(c *gin.Context)
+	ReprocessReceipt(c *gin.Context)
+	FlagReceipt(c *gin.Context)
+	GetReceipt(c *gin.Context)
+	ListReceipts(c *gin.Context)
+	GetUserPoints(c *gin.Context)
+	ListUserReceipts(c *gin.Context)
+	GetUserLedger(c *gin.Context)
+	RedeemPoints(c *gin.Context)
 }
 
+// cleanupTimeout bounds the writes that undo a failed submission.
+const cleanupTimeout = 5 * time.Second
+
+// UserIDHeader identifies the user a receipt submitted with an API key
+// belongs to. Bearer tokens always submit for their own subject.
+const UserIDHeader = "X-User-ID"
+
 type receiptHandler struct {
 	service   receipt.ReceiptService
 	sqsClient aws.SQSClient
+	logger    *slog.Logger
+	maxBatch  int
+	maxBytes  int64
 }
 
-func NewReceiptHandler(service receipt.ReceiptService, sqs aws.SQSClient) ReceiptHandler {
-	return &receiptHandler{service: service, sqsClient: sqs}
+// NewReceiptHandler returns the receipt and user handlers. POST
+// /receipts/batch accepts up to maxBatch receipts in a body of up to maxBytes.
+func NewReceiptHandler(service receipt.ReceiptService, sqs aws.SQSClient, logger *slog.Logger, maxBatch int, maxBytes int64) ReceiptHandler {
+	return &receiptHandler{service: service, sqsClient: sqs, logger: logger, maxBatch: maxBatch, maxBytes: maxBytes}
 }
 
 // POST /receipts/process
@@ -33,71 +63,468 @@ func (h *receiptHandler) QueueReceipt(c *gin.Context) {
 		return
 	}
 
-	// Assign ID + set to PENDING
+	// Reject structurally invalid receipts now instead of failing them asynchronously
+	if issues := h.service.ValidateReceipt(&r); len(issues) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":            "Invalid receipt",
+			"validationErrors": issues,
+		})
+		return
+	}
+
+	// Assign ID + owner + set to PENDING
 	r.ID = uuid.NewString()
-	r.Status = "PENDING"
+	r.UserID = submitter(c)
+	r.Status = models.StatusPending
+
+	// A retried request with the same Idempotency-Key gets the original receipt back
+	key := c.GetHeader("Idempotency-Key")
+	if key != "" {
+		originalID, claimed, err := h.service.ReserveIdempotencyKey(c.Request.Context(), key, &r)
+		if stderrors.Is(err, errors.ErrIdempotencyKeyReused) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check Idempotency-Key"})
+			return
+		}
+		if !claimed {
+			h.logger.InfoContext(c.Request.Context(), "Replaying idempotent submission", "receipt_id", originalID)
+			c.Header("Idempotent-Replayed", "true")
+			c.JSON(http.StatusAccepted, gin.H{"id": originalID, "status": "Receipt queued"})
+			return
+		}
+	}
 
 	// store in-memory so GET can see "PENDING"
-	if err := h.service.StorePendingReceipt(&r); err != nil {
+	if err := h.service.StorePendingReceipt(c.Request.Context(), &r); err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to store pending receipt", "receipt_id", r.ID, "error", err)
+		h.releaseIdempotencyKey(c, key)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store pending receipt"})
 		return
 	}
 
 	// enqueue message for the worker
-	if err := h.sqsClient.SendMessage(r); err != nil {
+	if err := h.sqsClient.SendMessage(c.Request.Context(), r); err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to enqueue receipt", "receipt_id", r.ID, "error", err)
+		h.failUnqueued(c, &r)
+		h.releaseIdempotencyKey(c, key)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enqueue receipt: " + err.Error()})
 		return
 	}
 
+	h.logger.InfoContext(c.Request.Context(), "Receipt queued", "receipt_id", r.ID, "user_id", r.UserID)
 	c.JSON(http.StatusAccepted, gin.H{"id": r.ID, "status": "Receipt queued"})
 }
 
+// submitter returns the user a submitted receipt belongs to: a bearer token's
+// subject, or whoever an API key caller names in UserIDHeader.
+func submitter(c *gin.Context) string {
+	if p, ok := auth.PrincipalFrom(c); ok && p.UserID != "" {
+		return p.UserID
+	}
+	return c.GetHeader(UserIDHeader)
+}
+
+// cleanupContext is for undoing a failed request's writes. It keeps the
+// request's values but not its cancellation: a client that disconnected is
+// the usual reason the request failed, and the cleanup must still run.
+func cleanupContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(c.Request.Context()), cleanupTimeout)
+}
+
+// failUnqueued marks a stored receipt that could not be enqueued FAILED, so
+// it isn't left PENDING with no message to process it.
+func (h *receiptHandler) failUnqueued(c *gin.Context, r *models.Receipt) {
+	ctx, cancel := cleanupContext(c)
+	defer cancel()
+	if err := h.service.FailPendingReceipt(ctx, r, "could not be queued for processing"); err != nil {
+		h.logger.ErrorContext(ctx, "Failed to mark unqueued receipt FAILED", "receipt_id", r.ID, "error", err)
+	}
+}
+
+// releaseIdempotencyKey lets the client retry a submission that failed
+// after its key was reserved.
+func (h *receiptHandler) releaseIdempotencyKey(c *gin.Context, key string) {
+	if key == "" {
+		return
+	}
+	ctx, cancel := cleanupContext(c)
+	defer cancel()
+	if err := h.service.ReleaseIdempotencyKey(ctx, key); err != nil {
+		h.logger.WarnContext(ctx, "Failed to release Idempotency-Key", "error", err)
+	}
+}
+
 // GET /receipts/:id/points
 func (h *receiptHandler) GetReceiptPoints(c *gin.Context) {
 	id := c.Param("id")
 
-	// Log what ID we're trying to retrieve
-	log.Printf("[GetReceiptPoints] Received request for ID: %s", id)
-
-	rec, err := h.service.GetReceipt(id)
-	log.Println("receipt from get ", rec)
+	rec, err := h.visibleReceipt(c, id)
 	if err != nil {
-		// Log the error that occurred while trying to get the receipt
-		log.Printf("[GetReceiptPoints] Could not find receipt with ID=%s: %v", id, err)
+		h.logger.DebugContext(c.Request.Context(), "Receipt not found", "receipt_id", id)
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
+	h.logger.DebugContext(c.Request.Context(), "Fetched receipt", "receipt", rec)
 
-	// Log the receipt's status and any error message before deciding the response
-	log.Printf("[GetReceiptPoints] Fetched Receipt => ID=%s, Status=%s, Points=%d, ErrorMessage=%q",
-		rec.ID, rec.Status, rec.Points, rec.ErrorMessage)
-
-	// Switch on status
 	switch rec.Status {
-	case "PENDING":
-		log.Printf("[GetReceiptPoints] Receipt is still PENDING for ID=%s", rec.ID)
+	case models.StatusPending, models.StatusProcessing:
 		c.JSON(http.StatusOK, gin.H{
-			"status":       "PENDING",
+			"status":       rec.Status,
 			"message":      "Still processing. Please try again later.",
 			"errorMessage": rec.ErrorMessage,
 			"pointsSoFar":  rec.Points,
 		})
-	case "FAILED":
-		log.Printf("[GetReceiptPoints] Receipt has FAILED for ID=%s, Reason=%s", rec.ID, rec.ErrorMessage)
+	case models.StatusFailed:
 		c.JSON(http.StatusBadRequest, gin.H{
-			"status":       "FAILED",
-			"errorMessage": rec.ErrorMessage,
+			"status":           models.StatusFailed,
+			"errorMessage":     rec.ErrorMessage,
+			"validationErrors": rec.ValidationErrors,
 		})
-	case "COMPLETED":
-		log.Printf("[GetReceiptPoints] Receipt is COMPLETED for ID=%s, Points=%d", rec.ID, rec.Points)
+	case models.StatusFlagged:
 		c.JSON(http.StatusOK, gin.H{
-			"status": "COMPLETED",
+			"status":     models.StatusFlagged,
+			"points":     0,
+			"flagReason": rec.FlagReason,
+		})
+	case models.StatusCompleted:
+		c.JSON(http.StatusOK, gin.H{
+			"status": models.StatusCompleted,
 			"points": rec.Points,
 		})
 	default:
-		log.Printf("[GetReceiptPoints] Receipt has UNKNOWN status for ID=%s: %s", rec.ID, rec.Status)
+		// Only reachable if the store holds a status outside models.ReceiptStatus
+		h.logger.ErrorContext(c.Request.Context(), "Receipt has unrecognized status", "receipt_id", rec.ID, "status", rec.Status)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unrecognized receipt status"})
+	}
+}
+
+// GET /receipts/:id/breakdown
+func (h *receiptHandler) GetReceiptBreakdown(c *gin.Context) {
+	id := c.Param("id")
+
+	rec, err := h.visibleReceipt(c, id)
+	if err != nil {
+		h.logger.DebugContext(c.Request.Context(), "Receipt not found", "receipt_id", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch rec.Status {
+	case models.StatusPending, models.StatusProcessing:
+		c.JSON(http.StatusOK, gin.H{
+			"status":  rec.Status,
+			"message": "Still processing. Please try again later.",
+		})
+	case models.StatusFailed:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":           models.StatusFailed,
+			"errorMessage":     rec.ErrorMessage,
+			"validationErrors": rec.ValidationErrors,
+		})
+	case models.StatusFlagged:
 		c.JSON(http.StatusOK, gin.H{
-			"status": "UNKNOWN",
+			"status":     models.StatusFlagged,
+			"points":     0,
+			"flagReason": rec.FlagReason,
 		})
+	case models.StatusCompleted:
+		c.JSON(http.StatusOK, gin.H{
+			"status":    models.StatusCompleted,
+			"points":    rec.Points,
+			"breakdown": rec.Breakdown,
+		})
+	default:
+		h.logger.ErrorContext(c.Request.Context(), "Receipt has unrecognized status", "receipt_id", rec.ID, "status", rec.Status)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unrecognized receipt status"})
+	}
+}
+
+// POST /receipts/:id/reprocess
+func (h *receiptHandler) ReprocessReceipt(c *gin.Context) {
+	id := c.Param("id")
+
+	rec, err := h.service.ReprocessReceipt(c.Request.Context(), id)
+	switch {
+	case stderrors.Is(err, errors.ErrReceiptNotExist):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case stderrors.Is(err, errors.ErrInvalidStatusTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": "Only COMPLETED, FAILED or FLAGGED receipts can be reprocessed"})
+		return
+	case err != nil:
+		h.logger.ErrorContext(c.Request.Context(), "Failed to reset receipt", "receipt_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset receipt"})
+		return
+	}
+
+	if err := h.sqsClient.SendMessage(c.Request.Context(), *rec); err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to enqueue receipt", "receipt_id", rec.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enqueue receipt: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"id": rec.ID, "status": "Receipt queued"})
+}
+
+// flagRequest is the body of POST /receipts/:id/flag.
+type flagRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// POST /receipts/:id/flag
+func (h *receiptHandler) FlagReceipt(c *gin.Context) {
+	id := c.Param("id")
+	var req flagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+
+	rec, err := h.service.FlagReceipt(c.Request.Context(), id, req.Reason)
+	switch {
+	case stderrors.Is(err, errors.ErrReceiptNotExist):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case stderrors.Is(err, errors.ErrInvalidStatusTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": "Only COMPLETED receipts can be flagged"})
+		return
+	case err != nil:
+		h.logger.ErrorContext(c.Request.Context(), "Failed to flag receipt", "receipt_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to flag receipt"})
+		return
+	}
+	c.JSON(http.StatusOK, rec)
+}
+
+// GET /receipts/:id
+func (h *receiptHandler) GetReceipt(c *gin.Context) {
+	rec, err := h.visibleReceipt(c, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rec)
+}
+
+// visibleReceipt fetches receipt id, treating another user's receipt as
+// missing for callers restricted to their own, so its existence doesn't leak.
+func (h *receiptHandler) visibleReceipt(c *gin.Context, id string) (*models.Receipt, error) {
+	rec, err := h.service.GetReceipt(c.Request.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if user := auth.RestrictedUser(c); user != "" && rec.UserID != user {
+		return nil, errors.ErrReceiptNotExist
+	}
+	return rec, nil
+}
+
+// GET /receipts?retailer=&status=&purchaseDateFrom=&purchaseDateTo=&minPoints=&maxPoints=&sort=&limit=&cursor=
+func (h *receiptHandler) ListReceipts(c *gin.Context) {
+	q, err := parseReceiptQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Tokens acting as a user only ever see that user's receipts
+	if user := auth.RestrictedUser(c); user != "" {
+		q.UserID = user
+	}
+
+	page, err := h.service.ListReceipts(c.Request.Context(), q)
+	if stderrors.Is(err, errors.ErrInvalidQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list receipts"})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GET /users/:id/points
+func (h *receiptHandler) GetUserPoints(c *gin.Context) {
+	userID := c.Param("id")
+	points, err := h.service.GetUserPoints(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to read points balance", "user_id", userID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read points balance"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"userId": userID, "points": points})
+}
+
+// GET /users/:id/ledger
+func (h *receiptHandler) GetUserLedger(c *gin.Context) {
+	userID := c.Param("id")
+	entries, err := h.service.GetUserLedger(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to read points ledger", "user_id", userID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read points ledger"})
+		return
+	}
+	if entries == nil {
+		entries = []models.LedgerEntry{}
+	}
+	c.JSON(http.StatusOK, gin.H{"userId": userID, "entries": entries})
+}
+
+// redemptionRequest is the body of POST /users/:id/redemptions.
+type redemptionRequest struct {
+	Points int `json:"points"`
+}
+
+// POST /users/:id/redemptions
+func (h *receiptHandler) RedeemPoints(c *gin.Context) {
+	userID := c.Param("id")
+	var req redemptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+	entryID := uuid.NewString()
+
+	// A retried request with the same Idempotency-Key gets the original entry back
+	key := c.GetHeader("Idempotency-Key")
+	if key != "" {
+		originalID, claimed, err := h.service.ReserveRedemptionKey(c.Request.Context(), key, userID, entryID, req.Points)
+		if stderrors.Is(err, errors.ErrIdempotencyKeyReused) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check Idempotency-Key"})
+			return
+		}
+		if !claimed {
+			h.replayRedemption(c, userID, originalID)
+			return
+		}
+		key = receipt.RedemptionKey(key)
+	}
+
+	entry, err := h.service.RedeemPoints(c.Request.Context(), userID, entryID, req.Points)
+	if err != nil {
+		h.releaseIdempotencyKey(c, key)
+	}
+	switch {
+	case stderrors.Is(err, errors.ErrInvalidRedemption):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case stderrors.Is(err, errors.ErrInsufficientPoints):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		h.logger.ErrorContext(c.Request.Context(), "Failed to redeem points", "user_id", userID, "points", req.Points, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeem points"})
+		return
+	}
+
+	balance, err := h.service.GetUserPoints(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to read points balance", "user_id", userID, "error", err)
+		c.JSON(http.StatusCreated, gin.H{"entry": entry})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"entry": entry, "balance": balance})
+}
+
+// replayRedemption answers a retried redemption with the entry the original
+// request wrote, without spending the points again.
+func (h *receiptHandler) replayRedemption(c *gin.Context, userID, entryID string) {
+	entries, err := h.service.GetUserLedger(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to read points ledger", "user_id", userID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read points ledger"})
+		return
+	}
+	for _, entry := range entries {
+		if entry.ID == entryID {
+			h.logger.InfoContext(c.Request.Context(), "Replaying idempotent redemption", "entry_id", entryID)
+			c.Header("Idempotent-Replayed", "true")
+			c.JSON(http.StatusCreated, gin.H{"entry": entry})
+			return
+		}
+	}
+	// The original request claimed the key but hasn't written its entry yet
+	c.JSON(http.StatusConflict, gin.H{"error": "A redemption with this Idempotency-Key is still in progress"})
+}
+
+// GET /users/:id/receipts accepts the same query parameters as GET /receipts
+func (h *receiptHandler) ListUserReceipts(c *gin.Context) {
+	q, err := parseReceiptQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.service.ListUserReceipts(c.Request.Context(), c.Param("id"), q)
+	if stderrors.Is(err, errors.ErrInvalidQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list receipts"})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// parseReceiptQuery reads ListReceipts' query parameters. sort is a field
+// name, prefixed with "-" for descending order.
+func parseReceiptQuery(c *gin.Context) (receipt.ReceiptQuery, error) {
+	q := receipt.ReceiptQuery{
+		Retailer:     c.Query("retailer"),
+		Status:       models.ReceiptStatus(strings.ToUpper(c.Query("status"))),
+		PurchasedGTE: c.Query("purchaseDateFrom"),
+		PurchasedLTE: c.Query("purchaseDateTo"),
+		Cursor:       c.Query("cursor"),
+	}
+
+	for _, date := range []string{q.PurchasedGTE, q.PurchasedLTE} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return q, fmt.Errorf("purchase date filter %q must be YYYY-MM-DD", date)
+		}
+	}
+
+	var err error
+	if q.MinPoints, err = optionalInt(c, "minPoints"); err != nil {
+		return q, err
+	}
+	if q.MaxPoints, err = optionalInt(c, "maxPoints"); err != nil {
+		return q, err
+	}
+	if limit, err := optionalInt(c, "limit"); err != nil {
+		return q, err
+	} else if limit != nil {
+		q.Limit = *limit
+	}
+
+	sortBy := c.Query("sort")
+	if strings.HasPrefix(sortBy, "-") {
+		q.Descending = true
+		sortBy = sortBy[1:]
+	}
+	q.SortBy = sortBy
+	return q, nil
+}
+
+// optionalInt parses an integer query parameter, returning nil when absent.
+func optionalInt(c *gin.Context, name string) (*int, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an integer", name)
 	}
+	return &n, nil
 }
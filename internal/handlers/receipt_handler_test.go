@@ -18,11 +18,25 @@ type ReceiptResponse struct {
 	ID string `json:"id"`
 }
 
+// testAPIKey is the example key docker-compose.yml configures.
+const testAPIKey = "local-dev-key"
+
+// apiRequest sends a JSON request authenticated with testAPIKey.
+func apiRequest(method, url string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", testAPIKey)
+	return http.DefaultClient.Do(req)
+}
+
 func TestIntegration_ProcessAndGetReceiptPoints(t *testing.T) {
 	tests := []struct {
 		name    string
 		payload string
-		// We always expect 202 now (the server enqueues everything)
+		// 202 once the receipt is queued, 400 if it fails validation at POST time
 		expectedPostStatus int
 		// This is what we want to find in the post response body (like `"id":`)
 		postResponseCheck string
@@ -70,11 +84,26 @@ func TestIntegration_ProcessAndGetReceiptPoints(t *testing.T) {
                 "items": [{"shortDescription": "Mountain Dew 12PK", "price": "6.49"}],
                 "total": "6.49"
             }`,
+			// Rejected inline, so nothing is stored or queued
+			expectedPostStatus: http.StatusBadRequest,
+			postResponseCheck:  `"field":"purchaseDate"`,
+			expectedGetStatus:  http.StatusNotFound,
+			getResponseCheck:   `receiptId doesn't exist`,
+		},
+		{
+			name: "Item prices don't add up to total",
+			payload: `{
+                "retailer": "Target",
+                "purchaseDate": "2022-01-01",
+                "purchaseTime": "13:01",
+                "items": [{"shortDescription": "Mountain Dew 12PK", "price": "6.49"}],
+                "total": "7.49"
+            }`,
+			// Structurally fine, so it is queued; the worker's full check fails it
 			expectedPostStatus: http.StatusAccepted,
 			postResponseCheck:  `"id":`,
-			// Worker would eventually reject it or never populate it
-			expectedGetStatus: http.StatusBadRequest,
-			getResponseCheck:  `errorMessage`,
+			expectedGetStatus:  http.StatusBadRequest,
+			getResponseCheck:   `mismatch`,
 		},
 		{
 			name: "Invalid JSON format",
@@ -95,9 +124,8 @@ func TestIntegration_ProcessAndGetReceiptPoints(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			// 1) POST /receipts/process
-			postResp, postErr := http.Post(
+			postResp, postErr := apiRequest(http.MethodPost,
 				"http://localhost:8080/receipts/process",
-				"application/json",
 				bytes.NewBuffer([]byte(tc.payload)),
 			)
 			if postErr != nil {
@@ -123,7 +151,7 @@ func TestIntegration_ProcessAndGetReceiptPoints(t *testing.T) {
 			time.Sleep(10 * time.Second)
 
 			// 4) GET /receipts/{id}/points => expect some 404 or "doesn't exist" because worker isn't done or the data is invalid
-			getResp, getErr := http.Get(fmt.Sprintf("http://localhost:8080/receipts/%s/points", rr.ID))
+			getResp, getErr := apiRequest(http.MethodGet, fmt.Sprintf("http://localhost:8080/receipts/%s/points", rr.ID), nil)
 			if getErr != nil {
 				t.Fatalf("Failed to send GET request: %v", getErr)
 			}
@@ -145,7 +173,7 @@ func TestIntegration_GetInvalidReceiptPoints(t *testing.T) {
 	time.Sleep(2 * time.Second)
 
 	invalidID := "non-existent-id"
-	resp, err := http.Get(fmt.Sprintf("http://localhost:8080/receipts/%s/points", invalidID))
+	resp, err := apiRequest(http.MethodGet, fmt.Sprintf("http://localhost:8080/receipts/%s/points", invalidID), nil)
 	if err != nil {
 		t.Fatalf("Failed to send GET request: %v", err)
 	}
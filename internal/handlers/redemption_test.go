@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kartikeya55555/fetch-assignment/internal/auth"
+	"github.com/kartikeya55555/fetch-assignment/internal/errors"
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	"github.com/kartikeya55555/fetch-assignment/internal/receipt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedeemPoints_IdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+	service := receipt.NewReceiptService(receipt.NewInMemoryStore(), receipt.NewDefaultPointsCalculator())
+	r := &models.Receipt{
+		ID: "r1", UserID: "alice", Retailer: "Target", PurchaseDate: "2022-01-01", PurchaseTime: "13:01",
+		Items: []models.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}}, Total: "6.49",
+	}
+	require.NoError(t, service.StorePendingReceipt(ctx, r))
+	_, err := service.ProcessReceipt(ctx, r)
+	require.NoError(t, err)
+	credited, err := service.GetUserPoints(ctx, "alice")
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, credited, 10)
+
+	router := newTestRouter(newTestHandler(service, nil), &auth.Principal{ID: "alice", UserID: "alice", Scopes: []auth.Scope{auth.ScopeSubmit}})
+	redeem := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/users/alice/redemptions", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	entryID := func(w *httptest.ResponseRecorder) string {
+		var resp struct{ Entry models.LedgerEntry }
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Entry.ID
+	}
+
+	first := redeem("k1", `{"points":10}`)
+	require.Equal(t, http.StatusCreated, first.Code)
+
+	// A retry replays the original entry instead of spending the points twice
+	retry := redeem("k1", `{"points":10}`)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, entryID(first), entryID(retry))
+	balance, err := service.GetUserPoints(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, credited-10, balance)
+
+	// The same key for a different redemption is refused
+	assert.Equal(t, http.StatusUnprocessableEntity, redeem("k1", `{"points":5}`).Code)
+
+	// A failed redemption releases its key, so the client can retry it
+	assert.Equal(t, http.StatusConflict, redeem("k2", `{"points":1000}`).Code)
+	w := redeem("k2", `{"points":1000}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), errors.ErrInsufficientPoints.Error())
+}
@@ -0,0 +1,20 @@
+package health
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler serves checker's report as JSON: 200 when every check passes, 503
+// otherwise, so it can back a Kubernetes probe directly.
+func Handler(checker Checker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := checker.Run(c.Request.Context())
+		status := http.StatusOK
+		if !report.Healthy() {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, report)
+	}
+}
@@ -0,0 +1,118 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Check reports whether one dependency is usable; a nil error means healthy.
+type Check func(ctx context.Context) error
+
+// Statuses reported for a whole Report and for each of its checks.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Result is the outcome of one Check.
+type Result struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// Report is the outcome of every check of a Checker. Status is StatusOK only
+// if every check passed.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Healthy reports whether every check passed.
+func (r Report) Healthy() bool {
+	return r.Status == StatusOK
+}
+
+// Checker runs a named set of checks.
+type Checker interface {
+	// Add registers check under name, replacing any check of that name.
+	Add(name string, check Check)
+	// Run runs every check concurrently, each bounded by the checker's
+	// timeout, and collects their results.
+	Run(ctx context.Context) Report
+}
+
+type checker struct {
+	mu      sync.RWMutex
+	checks  map[string]Check
+	timeout time.Duration
+}
+
+// NewChecker returns a Checker that fails any check still running after
+// timeout.
+func NewChecker(timeout time.Duration) Checker {
+	return &checker{checks: make(map[string]Check), timeout: timeout}
+}
+
+func (c *checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+func (c *checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := make(map[string]Check, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mu.RUnlock()
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		report = Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+	)
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			result := c.run(ctx, check)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusFail
+			}
+		}(name, check)
+	}
+	wg.Wait()
+	return report
+}
+
+// run runs one check, giving up once the timeout passes even if the check
+// ignores ctx.
+func (c *checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", c.timeout)
+	}
+
+	result := Result{Status: StatusOK, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,81 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker_ReportsEachCheck(t *testing.T) {
+	c := NewChecker(20 * time.Millisecond)
+	c.Add("store", func(ctx context.Context) error { return nil })
+	c.Add("sqs", func(ctx context.Context) error { return fmt.Errorf("connection refused") })
+	// Ignores ctx, so only the checker's own timeout ends it
+	c.Add("sns", func(ctx context.Context) error { time.Sleep(200 * time.Millisecond); return nil })
+
+	report := c.Run(context.Background())
+	assert.False(t, report.Healthy())
+	assert.Equal(t, StatusOK, report.Checks["store"].Status)
+	assert.Equal(t, StatusFail, report.Checks["sqs"].Status)
+	assert.Equal(t, "connection refused", report.Checks["sqs"].Error)
+	assert.Equal(t, StatusFail, report.Checks["sns"].Status)
+	assert.Contains(t, report.Checks["sns"].Error, "timed out")
+}
+
+func TestChecker_HealthyWithoutChecks(t *testing.T) {
+	report := NewChecker(time.Second).Run(context.Background())
+	assert.True(t, report.Healthy())
+	assert.Empty(t, report.Checks)
+}
+
+func TestFresh(t *testing.T) {
+	var last time.Time
+	check := Fresh(func() time.Time { return last }, time.Minute)
+
+	assert.ErrorContains(t, check(context.Background()), "no heartbeat")
+	last = time.Now().Add(-2 * time.Minute)
+	assert.ErrorContains(t, check(context.Background()), "last heartbeat")
+	last = time.Now()
+	assert.NoError(t, check(context.Background()))
+}
+
+func TestHandler(t *testing.T) {
+	c := NewChecker(time.Second)
+	healthy := true
+	c.Add("store", func(ctx context.Context) error {
+		if !healthy {
+			return fmt.Errorf("disk I/O error")
+		}
+		return nil
+	})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/readyz", Handler(c))
+
+	get := func() (*httptest.ResponseRecorder, Report) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var report Report
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		return w, report
+	}
+
+	w, report := get()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, StatusOK, report.Checks["store"].Status)
+
+	healthy = false
+	w, report = get()
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, "disk I/O error", report.Checks["store"].Error)
+}
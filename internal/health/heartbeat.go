@@ -0,0 +1,22 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Fresh returns a Check that fails when last, the time something last showed
+// progress, is zero or older than maxAge.
+func Fresh(last func() time.Time, maxAge time.Duration) Check {
+	return func(ctx context.Context) error {
+		t := last()
+		if t.IsZero() {
+			return fmt.Errorf("no heartbeat yet")
+		}
+		if age := time.Since(t); age > maxAge {
+			return fmt.Errorf("last heartbeat %s ago (limit %s)", age.Round(time.Second), maxAge)
+		}
+		return nil
+	}
+}
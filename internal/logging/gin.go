@@ -0,0 +1,41 @@
+package logging
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the request ID: taken from the caller if present,
+// generated otherwise, and always echoed in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// Gin tags every request's context with a request_id, so everything logged
+// while serving it can be correlated, and logs one line per request.
+func Gin(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" || len(requestID) > 128 {
+			requestID = uuid.NewString()
+		}
+		c.Header(RequestIDHeader, requestID)
+		c.Request = c.Request.WithContext(With(c.Request.Context(), slog.String("request_id", requestID)))
+
+		c.Next()
+
+		level := slog.LevelInfo
+		if c.Writer.Status() >= 500 {
+			level = slog.LevelError
+		}
+		logger.Log(c.Request.Context(), level, "request completed",
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+			"status", c.Writer.Status(),
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
@@ -0,0 +1,99 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Redacted replaces the value of any attribute that may hold receipt
+// contents or other personal data.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys, lower-cased, whose values are never
+// written out. They cover receipt contents, which can identify a shopper's
+// purchases, raw message bodies, which contain whole receipts, and
+// credentials.
+var sensitiveKeys = map[string]bool{
+	"retailer":         true,
+	"purchasedate":     true,
+	"purchasetime":     true,
+	"total":            true,
+	"items":            true,
+	"shortdescription": true,
+	"price":            true,
+	"body":             true,
+	"api_key":          true,
+	"authorization":    true,
+}
+
+// ParseLevel maps LOG_LEVEL values (debug, info, warn, error) to a level.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", s)
+	}
+	return level, nil
+}
+
+// New returns a JSON logger writing to w at level and above. Records pick up
+// the fields added to their context with With, plus the trace and span IDs of
+// the active span, and sensitive attributes are redacted.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	json := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	})
+	return slog.New(contextHandler{json})
+}
+
+// redact blanks out sensitiveKeys, at any nesting depth.
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
+
+type ctxKey struct{}
+
+// With returns a copy of ctx whose log records carry attrs, e.g. the request
+// or receipt ID, in addition to any added earlier.
+func With(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(ctxKey{}).([]slog.Attr)
+	merged := make([]slog.Attr, 0, len(existing)+len(attrs))
+	merged = append(merged, existing...)
+	merged = append(merged, attrs...)
+	return context.WithValue(ctx, ctxKey{}, merged)
+}
+
+// contextHandler adds the attributes stored by With and the active span's
+// IDs to every record logged with a context.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(ctxKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
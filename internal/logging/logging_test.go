@@ -0,0 +1,123 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// lines decodes each JSON record written to buf.
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var rec map[string]any
+		require.NoError(t, dec.Decode(&rec))
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestNew_RedactsReceiptContents(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+
+	r := models.Receipt{
+		ID:       "r1",
+		UserID:   "u1",
+		Status:   models.StatusCompleted,
+		Retailer: "Target",
+		Total:    "6.49",
+		Items:    []models.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}},
+		Points:   12,
+	}
+	logger.Info("receipt", "receipt", r)
+	logger.Info("raw", "retailer", "Target", slog.Group("item", "shortDescription", "Dew", "price", "6.49"), "body", `{"retailer":"Target"}`)
+
+	out := buf.String()
+	assert.NotContains(t, out, "Target")
+	assert.NotContains(t, out, "Dew")
+	assert.NotContains(t, out, "6.49")
+
+	records := lines(t, &buf)
+	require.Len(t, records, 2)
+	assert.Equal(t, map[string]any{
+		"id": "r1", "userId": "u1", "status": "COMPLETED", "points": float64(12), "itemCount": float64(1),
+	}, records[0]["receipt"])
+	assert.Equal(t, Redacted, records[1]["retailer"])
+	assert.Equal(t, Redacted, records[1]["item"].(map[string]any)["price"])
+	assert.Equal(t, Redacted, records[1]["body"])
+}
+
+func TestNew_AddsContextFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+
+	ctx := With(context.Background(), slog.String("request_id", "req-1"))
+	ctx = With(ctx, slog.String("receipt_id", "r1"))
+	ctx = trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{2},
+	}))
+	logger.InfoContext(ctx, "hello")
+	logger.DebugContext(ctx, "below the level")
+
+	records := lines(t, &buf)
+	require.Len(t, records, 1)
+	assert.Equal(t, "req-1", records[0]["request_id"])
+	assert.Equal(t, "r1", records[0]["receipt_id"])
+	assert.Equal(t, "01000000000000000000000000000000", records[0]["trace_id"])
+	assert.Equal(t, "0200000000000000", records[0]["span_id"])
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("warn")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelWarn, level)
+
+	_, err = ParseLevel("loud")
+	assert.Error(t, err)
+}
+
+func TestGin_TagsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Gin(logger))
+	r.GET("/receipts/:id", func(c *gin.Context) {
+		logger.InfoContext(c.Request.Context(), "in handler")
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/receipts/abc", nil)
+	req.Header.Set(RequestIDHeader, "caller-id")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "caller-id", w.Header().Get(RequestIDHeader))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/receipts/abc", nil))
+	generated := w.Header().Get(RequestIDHeader)
+	assert.NotEmpty(t, generated)
+
+	records := lines(t, &buf)
+	require.Len(t, records, 4)
+	assert.Equal(t, "caller-id", records[0]["request_id"])
+	assert.Equal(t, "caller-id", records[1]["request_id"])
+	assert.Equal(t, "/receipts/:id", records[1]["route"])
+	assert.Equal(t, float64(http.StatusOK), records[1]["status"])
+	assert.Equal(t, generated, records[3]["request_id"])
+}
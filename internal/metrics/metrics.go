@@ -0,0 +1,186 @@
+package metrics
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "receipts"
+
+// Collectors registered with the default Prometheus registry, which /metrics
+// serves.
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route template.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	BatchReceipts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "batch_receipts_total",
+		Help:      "Receipts submitted through POST /receipts/batch, by outcome (queued, invalid or failed).",
+	}, []string{"result"})
+
+	MessagesReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "worker_messages_received_total",
+		Help:      "SQS messages handed to the processor.",
+	})
+
+	MessagesProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "worker_messages_processed_total",
+		Help:      "Messages finished successfully, by resulting receipt status (SKIPPED for stale deliveries).",
+	}, []string{"status"})
+
+	MessagesFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "worker_messages_failed_total",
+		Help:      "Messages that failed, by whether they will be retried (retryable) or not (permanent).",
+	}, []string{"reason"})
+
+	ProcessDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "process_receipt_duration_seconds",
+		Help:      "Time spent in ReceiptService.ProcessReceipt.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	Points = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "points_awarded",
+		Help:      "Points awarded per completed receipt.",
+		Buckets:   []float64{0, 10, 25, 50, 75, 100, 150, 200, 300, 500},
+	})
+
+	// MessageLag stands in for SQS's ApproximateAgeOfOldestMessage, which only
+	// CloudWatch reports.
+	MessageLag = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "worker_message_lag_seconds",
+		Help:      "Time from SendMessage until a worker received the message, per delivery.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 15, 30, 60, 300, 900, 3600},
+	})
+
+	AWSErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "aws_errors_total",
+		Help:      "Failed SQS and SNS API calls, by service and operation.",
+	}, []string{"service", "operation"})
+)
+
+// Gin records HTTPRequests and HTTPDuration for every request, labelled with
+// the route template (e.g. /receipts/:id) so IDs don't explode cardinality.
+func Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		HTTPRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		HTTPDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the default registry. With a token, scrapes must send
+// "Authorization: Bearer <token>"; without one /metrics is open and must not
+// be reachable from outside the deployment.
+func Handler(token string) gin.HandlerFunc {
+	serve := gin.WrapH(promhttp.Handler())
+	if token == "" {
+		return serve
+	}
+	want := []byte("Bearer " + token)
+	return func(c *gin.Context) {
+		got := []byte(c.GetHeader("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid credentials"})
+			return
+		}
+		serve(c)
+	}
+}
+
+// countCollector reports gauges labelled by key, read with count at scrape
+// time.
+type countCollector[K ~string] struct {
+	what  string // what is counted, for the error log
+	count func(ctx context.Context) (map[K]int, error)
+	desc  *prometheus.Desc
+}
+
+// RegisterStoreSize exposes receipts_stored{status} using count, typically
+// ReceiptStore.CountReceipts.
+func RegisterStoreSize(count func(ctx context.Context) (map[models.ReceiptStatus]int, error)) error {
+	return prometheus.Register(newStoreCollector(count))
+}
+
+func newStoreCollector(count func(ctx context.Context) (map[models.ReceiptStatus]int, error)) *countCollector[models.ReceiptStatus] {
+	return &countCollector[models.ReceiptStatus]{
+		what:  "stored receipts",
+		count: count,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "stored"),
+			"Receipts in the store, by status.",
+			[]string{"status"}, nil,
+		),
+	}
+}
+
+// RegisterQueueDepth exposes receipts_queue_messages{state} using depth,
+// typically SQSClient.QueueDepth.
+func RegisterQueueDepth(depth func(ctx context.Context) (map[string]int, error)) error {
+	return prometheus.Register(newQueueCollector(depth))
+}
+
+func newQueueCollector(depth func(ctx context.Context) (map[string]int, error)) *countCollector[string] {
+	return &countCollector[string]{
+		what:  "queued messages",
+		count: depth,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "queue", "messages"),
+			"Approximate messages in the SQS queue, by state (visible, in_flight or delayed).",
+			[]string{"state"}, nil,
+		),
+	}
+}
+
+func (c *countCollector[K]) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *countCollector[K]) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	counts, err := c.count(ctx)
+	if err != nil {
+		slog.Error("Failed to count "+c.what, "error", err)
+		return
+	}
+	for key, n := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), string(key))
+	}
+}
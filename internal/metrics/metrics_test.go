@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGin_LabelsByRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Gin())
+	r.GET("/receipts/:id", func(c *gin.Context) { c.Status(http.StatusNotFound) })
+
+	for _, path := range []string{"/receipts/a", "/receipts/b", "/nowhere"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(HTTPRequests.WithLabelValues("GET", "/receipts/:id", "404")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(HTTPRequests.WithLabelValues("GET", "unmatched", "404")))
+}
+
+func TestStoreCollector(t *testing.T) {
+	c := newStoreCollector(func(ctx context.Context) (map[models.ReceiptStatus]int, error) {
+		return map[models.ReceiptStatus]int{models.StatusPending: 2, models.StatusCompleted: 5}, nil
+	})
+
+	expected := `
+# HELP receipts_stored Receipts in the store, by status.
+# TYPE receipts_stored gauge
+receipts_stored{status="COMPLETED"} 5
+receipts_stored{status="PENDING"} 2
+`
+	require.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+}
+
+func TestQueueCollector(t *testing.T) {
+	c := newQueueCollector(func(ctx context.Context) (map[string]int, error) {
+		return map[string]int{"visible": 42, "in_flight": 7, "delayed": 0}, nil
+	})
+
+	expected := `
+# HELP receipts_queue_messages Approximate messages in the SQS queue, by state (visible, in_flight or delayed).
+# TYPE receipts_queue_messages gauge
+receipts_queue_messages{state="delayed"} 0
+receipts_queue_messages{state="in_flight"} 7
+receipts_queue_messages{state="visible"} 42
+`
+	require.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+}
+
+func TestHandler_Token(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/metrics", Handler("scrape-secret"))
+
+	for _, tc := range []struct {
+		name   string
+		header string
+		status int
+	}{
+		{"No credentials", "", http.StatusUnauthorized},
+		{"Wrong token", "Bearer nope", http.StatusUnauthorized},
+		{"Right token", "Bearer scrape-secret", http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tc.status, w.Code)
+		})
+	}
+}
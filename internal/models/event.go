@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// ReceiptEventSchemaVersion is bumped whenever ReceiptEvent changes in a way
+// subscribers must handle; additive fields keep the same version.
+const ReceiptEventSchemaVersion = "1"
+
+// Event types published to SNS, also sent as the "eventType" message attribute.
+const (
+	EventReceiptCompleted = "receipt.completed"
+	EventReceiptFailed    = "receipt.failed"
+	EventReceiptFlagged   = "receipt.flagged"
+)
+
+// ReceiptEvent is the JSON payload published to SNS after the worker
+// finishes a receipt.
+type ReceiptEvent struct {
+	SchemaVersion string    `json:"schemaVersion"`
+	EventType     string    `json:"eventType"`
+	OccurredAt    time.Time `json:"occurredAt"`
+
+	ReceiptID    string        `json:"receiptId"`
+	Status       ReceiptStatus `json:"status"`
+	Retailer     string        `json:"retailer"`
+	PurchaseDate string        `json:"purchaseDate"`
+	PurchaseTime string        `json:"purchaseTime"`
+	Points       int           `json:"points"`
+	Errors       []string      `json:"errors,omitempty"`     // only set for receipt.failed
+	FlagReason   string        `json:"flagReason,omitempty"` // only set for receipt.flagged
+}
+
+// NewReceiptEvent builds an event of eventType describing r's current state.
+func NewReceiptEvent(eventType string, r *Receipt) ReceiptEvent {
+	return ReceiptEvent{
+		SchemaVersion: ReceiptEventSchemaVersion,
+		EventType:     eventType,
+		OccurredAt:    time.Now().UTC(),
+		ReceiptID:     r.ID,
+		Status:        r.Status,
+		Retailer:      r.Retailer,
+		PurchaseDate:  r.PurchaseDate,
+		PurchaseTime:  r.PurchaseTime,
+		Points:        r.Points,
+		FlagReason:    r.FlagReason,
+	}
+}
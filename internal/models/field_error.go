@@ -0,0 +1,8 @@
+package models
+
+// FieldError describes one validation problem with a receipt.
+type FieldError struct {
+	Field   string `json:"field"`   // JSON path, e.g. "items[0].price"
+	Code    string `json:"code"`    // machine-readable reason, e.g. "required", "format"
+	Message string `json:"message"` // human-readable explanation
+}
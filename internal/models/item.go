@@ -1,6 +1,8 @@
 package models
 
 type Item struct {
-	ShortDescription string `json:"shortDescription" validate:"required"`
-	Price            string `json:"price" validate:"required"`
+	ShortDescription string `json:"shortDescription" validate:"required,description"`
+	Price            string `json:"price" validate:"required,amount"`
+
+	PriceCents int64 `json:"-"` // Price in cents, set by validation
 }
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// LedgerEntryKind says why a ledger entry changed a user's balance.
+type LedgerEntryKind string
+
+const (
+	LedgerCredit   LedgerEntryKind = "CREDIT"   // points earned by a completed receipt
+	LedgerDebit    LedgerEntryKind = "DEBIT"    // points spent on a redemption
+	LedgerReversal LedgerEntryKind = "REVERSAL" // points taken back from a receipt later flagged or rescored
+)
+
+// LedgerEntry is one change to a user's points balance. Entries are never
+// updated or deleted; a user's balance is the sum of their entries.
+type LedgerEntry struct {
+	ID        string          `json:"id"`
+	UserID    string          `json:"userId"`
+	ReceiptID string          `json:"receiptId,omitempty"` // empty for debits
+	Kind      LedgerEntryKind `json:"kind"`
+	Points    int             `json:"points"` // negative for debits and reversals
+	CreatedAt time.Time       `json:"createdAt"`
+}
@@ -1,14 +1,44 @@
 package models
 
+import "log/slog"
+
 type Receipt struct {
-	ID           string `json:"id"`     // auto-generated, so no validation here
-	Status       string `json:"status"` // PENDING, COMPLETED, or FAILED
-	ErrorMessage string `json:"errorMessage,omitempty"`
-
-	Retailer     string `json:"retailer" validate:"required"`
-	PurchaseDate string `json:"purchaseDate" validate:"required"`
-	PurchaseTime string `json:"purchaseTime" validate:"required"`
-	Total        string `json:"total" validate:"required"`
-	Items        []Item `json:"items" validate:"required,dive"` // "dive" ensures each item is validated
-	Points       int    `json:"points"`                         // calculated later, so no validation
+	ID           string        `json:"id"`     // auto-generated, so no validation here
+	Status       ReceiptStatus `json:"status"` // only changed along the transitions in status.go
+	ErrorMessage string        `json:"errorMessage,omitempty"`
+	// ValidationErrors itemizes ErrorMessage when validation failed
+	ValidationErrors []FieldError `json:"validationErrors,omitempty"`
+	// FlagReason explains why a FLAGGED receipt was not awarded points
+	FlagReason  string `json:"flagReason,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"` // hash of the normalized receipt contents
+	UserID      string `json:"userId,omitempty"`      // submitting user, taken from the X-User-ID header
+
+	Retailer     string `json:"retailer" validate:"required,retailer"`
+	PurchaseDate string `json:"purchaseDate" validate:"required,datetime=2006-01-02"`
+	PurchaseTime string `json:"purchaseTime" validate:"required,datetime=15:04"`
+	Total        string `json:"total" validate:"required,amount"`
+	Items        []Item `json:"items" validate:"required,min=1,dive"` // "dive" ensures each item is validated
+	Points       int    `json:"points"`                               // calculated later, so no validation
+	TotalCents   int64  `json:"-"`                                    // Total in cents, set by validation
+
+	Breakdown []PointsEntry `json:"breakdown,omitempty"` // per-rule explanation of Points
+}
+
+// LogValue keeps receipt contents out of logs: a logged receipt only shows
+// its ID, owner, status, points and how many items it has.
+func (r Receipt) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", r.ID),
+		slog.String("userId", r.UserID),
+		slog.String("status", string(r.Status)),
+		slog.Int("points", r.Points),
+		slog.Int("itemCount", len(r.Items)),
+	)
+}
+
+// PointsEntry records what one points rule awarded for a receipt and why.
+type PointsEntry struct {
+	Rule   string `json:"rule"`
+	Points int    `json:"points"`
+	Reason string `json:"reason"`
 }
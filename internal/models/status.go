@@ -0,0 +1,50 @@
+package models
+
+// ReceiptStatus is where a receipt is in its processing lifecycle.
+type ReceiptStatus string
+
+const (
+	StatusPending    ReceiptStatus = "PENDING"    // stored by the API, waiting in the queue
+	StatusProcessing ReceiptStatus = "PROCESSING" // picked up by a worker
+	StatusCompleted  ReceiptStatus = "COMPLETED"  // validated and scored
+	StatusFailed     ReceiptStatus = "FAILED"     // failed validation, or never reached the queue
+	StatusFlagged    ReceiptStatus = "FLAGGED"    // duplicate of an earlier receipt, no points
+)
+
+// transitions lists the statuses each status may move to.
+//
+//	PENDING -> PROCESSING -> COMPLETED | FAILED | FLAGGED
+//
+// PENDING -> FAILED is for receipts the API stored but could not enqueue,
+// and COMPLETED -> FLAGGED for receipts an admin flags after the fact.
+// PROCESSING -> PROCESSING lets a redelivered message resume after a worker
+// died mid-way. Finished receipts only go back to PENDING when explicitly
+// reprocessed, so a late duplicate message can never overwrite them.
+var transitions = map[ReceiptStatus][]ReceiptStatus{
+	StatusPending:    {StatusProcessing, StatusFailed},
+	StatusProcessing: {StatusProcessing, StatusCompleted, StatusFailed, StatusFlagged},
+	StatusCompleted:  {StatusPending, StatusFlagged},
+	StatusFailed:     {StatusPending},
+	StatusFlagged:    {StatusPending},
+}
+
+// CanTransitionTo reports whether a receipt in status s may move to next.
+func (s ReceiptStatus) CanTransitionTo(next ReceiptStatus) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValid reports whether s is one of the statuses above.
+func (s ReceiptStatus) IsValid() bool {
+	_, ok := transitions[s]
+	return ok
+}
+
+// IsFinal reports whether processing has finished for a receipt in status s.
+func (s ReceiptStatus) IsFinal() bool {
+	return s == StatusCompleted || s == StatusFailed || s == StatusFlagged
+}
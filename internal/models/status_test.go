@@ -0,0 +1,28 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReceiptStatus_CanTransitionTo(t *testing.T) {
+	assert.True(t, StatusPending.CanTransitionTo(StatusProcessing))
+	assert.True(t, StatusProcessing.CanTransitionTo(StatusProcessing))
+	assert.True(t, StatusProcessing.CanTransitionTo(StatusCompleted))
+	assert.True(t, StatusPending.CanTransitionTo(StatusFailed))
+	assert.True(t, StatusCompleted.CanTransitionTo(StatusPending))
+	assert.True(t, StatusCompleted.CanTransitionTo(StatusFlagged))
+
+	// A late redelivery must not be able to touch a finished receipt
+	assert.False(t, StatusCompleted.CanTransitionTo(StatusProcessing))
+	assert.False(t, StatusCompleted.CanTransitionTo(StatusFailed))
+	assert.False(t, StatusPending.CanTransitionTo(StatusCompleted))
+	assert.False(t, ReceiptStatus("BOGUS").CanTransitionTo(StatusPending))
+}
+
+func TestReceiptStatus_IsValid(t *testing.T) {
+	assert.True(t, StatusFlagged.IsValid())
+	assert.False(t, ReceiptStatus("COMPLETE").IsValid())
+	assert.False(t, ReceiptStatus("").IsValid())
+}
@@ -0,0 +1,30 @@
+package money
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// amountPattern is the API's money format: whole dollars and exactly two
+// decimal places, e.g. "6.49".
+var amountPattern = regexp.MustCompile(`^\d+\.\d{2}$`)
+
+// ParseCents converts an amount such as "6.49" into integer cents (649)
+// without going through float64, so values like "3.35" stay exact.
+func ParseCents(amount string) (int64, error) {
+	if !amountPattern.MatchString(amount) {
+		return 0, fmt.Errorf("amount %q is not in 0.00 format", amount)
+	}
+	cents, err := strconv.ParseInt(strings.Replace(amount, ".", "", 1), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("amount %q is out of range", amount)
+	}
+	return cents, nil
+}
+
+// FormatCents renders cents back in the API's "0.00" format.
+func FormatCents(cents int64) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
@@ -0,0 +1,36 @@
+package money
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCents(t *testing.T) {
+	tests := []struct {
+		amount  string
+		cents   int64
+		wantErr bool
+	}{
+		{amount: "6.49", cents: 649},
+		{amount: "3.35", cents: 335},
+		{amount: "0.00", cents: 0},
+		{amount: "1200.10", cents: 120010},
+		{amount: "6.4", wantErr: true},
+		{amount: "6", wantErr: true},
+		{amount: "-1.00", wantErr: true},
+		{amount: "1e2.00", wantErr: true},
+		{amount: "99999999999999999999.00", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		cents, err := ParseCents(tc.amount)
+		if tc.wantErr {
+			assert.Error(t, err, tc.amount)
+			continue
+		}
+		assert.NoError(t, err, tc.amount)
+		assert.Equal(t, tc.cents, cents, tc.amount)
+		assert.Equal(t, tc.amount, FormatCents(cents))
+	}
+}
@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Decision is the outcome of one Allow or AllowN call.
+type Decision struct {
+	Allowed    bool
+	Limit      int           // bucket capacity
+	Remaining  int           // whole tokens left after this request
+	RetryAfter time.Duration // until the next token, when not Allowed
+	Reset      time.Duration // until the bucket is full again
+}
+
+// Limiter decides whether the caller identified by key may make a request.
+type Limiter interface {
+	Allow(key string) Decision
+	// AllowN charges n requests at once. A charge larger than the bucket is
+	// allowed from a full bucket and leaves the caller waiting for the
+	// excess to refill.
+	AllowN(key string, n int) Decision
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type tokenBucket struct {
+	mu      sync.Mutex
+	rate    float64 // tokens added per second
+	burst   int
+	buckets map[string]*bucket
+	now     func() time.Time
+
+	lastSweep time.Time
+}
+
+// sweepEvery is how often buckets that have refilled completely, and so are
+// indistinguishable from new ones, are dropped.
+const sweepEvery = time.Minute
+
+// NewTokenBucket allows each key bursts of up to burst requests, refilled at
+// perMinute requests per minute.
+func NewTokenBucket(perMinute, burst int) Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return newTokenBucket(perMinute, burst, time.Now)
+}
+
+func newTokenBucket(perMinute, burst int, now func() time.Time) *tokenBucket {
+	return &tokenBucket{
+		rate:      float64(perMinute) / 60,
+		burst:     burst,
+		buckets:   make(map[string]*bucket),
+		now:       now,
+		lastSweep: now(),
+	}
+}
+
+func (l *tokenBucket) Allow(key string) Decision {
+	return l.AllowN(key, 1)
+}
+
+func (l *tokenBucket) AllowN(key string, n int) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.burst), b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	d := Decision{Limit: l.burst}
+	if need := float64(min(n, l.burst)); b.tokens >= need {
+		b.tokens -= float64(n)
+		d.Allowed = true
+	} else {
+		d.RetryAfter = l.timeFor(need - b.tokens)
+	}
+	d.Remaining = max(int(b.tokens), 0)
+	d.Reset = l.timeFor(float64(l.burst) - b.tokens)
+	return d
+}
+
+// timeFor is how long refilling n tokens takes.
+func (l *tokenBucket) timeFor(n float64) time.Duration {
+	return time.Duration(n / l.rate * float64(time.Second))
+}
+
+// sweep drops full buckets; callers hold l.mu.
+func (l *tokenBucket) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepEvery {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newTokenBucket(60, 3, func() time.Time { return now })
+
+	for i := 2; i >= 0; i-- {
+		d := l.Allow("a")
+		require.True(t, d.Allowed)
+		assert.Equal(t, i, d.Remaining)
+	}
+
+	d := l.Allow("a")
+	assert.False(t, d.Allowed)
+	assert.Equal(t, time.Second, d.RetryAfter)
+	assert.Equal(t, 3*time.Second, d.Reset)
+
+	// Other keys have their own bucket
+	assert.True(t, l.Allow("b").Allowed)
+
+	// One token per second at 60 per minute
+	now = now.Add(time.Second)
+	assert.True(t, l.Allow("a").Allowed)
+	assert.False(t, l.Allow("a").Allowed)
+
+	// Refilled buckets are swept
+	now = now.Add(2 * sweepEvery)
+	l.Allow("c")
+	assert.Len(t, l.buckets, 1)
+}
+
+func TestTokenBucket_AllowN(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newTokenBucket(60, 5, func() time.Time { return now })
+
+	d := l.AllowN("a", 3)
+	require.True(t, d.Allowed)
+	assert.Equal(t, 2, d.Remaining)
+
+	d = l.AllowN("a", 3)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, time.Second, d.RetryAfter)
+
+	// More than the burst needs a full bucket and then waits off the excess
+	now = now.Add(3 * time.Second)
+	d = l.AllowN("a", 8)
+	require.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Equal(t, 8*time.Second, d.Reset)
+	now = now.Add(3 * time.Second)
+	assert.False(t, l.Allow("a").Allowed)
+	now = now.Add(time.Second)
+	assert.True(t, l.Allow("a").Allowed)
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/receipts/process", Middleware(NewTokenBucket(1, 1)), func(c *gin.Context) {
+		c.Status(http.StatusAccepted)
+	})
+
+	send := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/receipts/process", nil))
+		return w
+	}
+
+	w := send()
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+
+	w = send()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+}
+
+func TestChargeN(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/receipts/batch", Middleware(NewTokenBucket(1, 3)), func(c *gin.Context) {
+		if ChargeN(c, 2) {
+			c.Status(http.StatusAccepted)
+		}
+	})
+	// Without Middleware nothing is charged
+	r.POST("/unlimited", func(c *gin.Context) {
+		assert.True(t, ChargeN(c, 100))
+	})
+
+	send := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		return w
+	}
+
+	w := send("/receipts/batch")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+
+	w = send("/receipts/batch")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	send("/unlimited")
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kartikeya55555/fetch-assignment/internal/auth"
+)
+
+// Middleware limits requests per caller: authenticated callers by their API
+// key ID or token subject, anonymous ones by client IP. Every response
+// carries the caller's quota in X-RateLimit-* headers; rejected requests get
+// 429 with Retry-After. Handlers whose requests cost more than one can charge
+// the rest with ChargeN.
+func Middleware(l Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := "ip:" + c.ClientIP()
+		if p, ok := auth.PrincipalFrom(c); ok && p.ID != "" {
+			key = "principal:" + p.ID
+		}
+		c.Set(callerKey, caller{l, key})
+
+		if !respond(c, key, l.Allow(key)) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// callerKey holds the caller Middleware charged in the Gin context.
+const callerKey = "ratelimit.caller"
+
+type caller struct {
+	limiter Limiter
+	key     string
+}
+
+// ChargeN charges n more requests to the caller's bucket, for requests that
+// turn out to be worth several, and updates the quota headers. When the
+// bucket can't cover them it writes the 429 and returns false. Routes without
+// Middleware are never limited.
+func ChargeN(c *gin.Context, n int) bool {
+	v, ok := c.Get(callerKey)
+	if !ok || n <= 0 {
+		return true
+	}
+	cl := v.(caller)
+	return respond(c, cl.key, cl.limiter.AllowN(cl.key, n))
+}
+
+// respond sets the quota headers for d and aborts with 429 unless it was
+// allowed. It reports whether it was.
+func respond(c *gin.Context, key string, d Decision) bool {
+	c.Header("X-RateLimit-Limit", strconv.Itoa(d.Limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	c.Header("X-RateLimit-Reset", strconv.Itoa(seconds(d.Reset)))
+	if !d.Allowed {
+		slog.WarnContext(c.Request.Context(), "Rate limit exceeded", "method", c.Request.Method, "route", c.FullPath(), "client", key)
+		c.Header("Retry-After", strconv.Itoa(seconds(d.RetryAfter)))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded, retry later"})
+	}
+	return d.Allowed
+}
+
+// seconds rounds d up to whole seconds, as the headers require.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,38 @@
+package receipt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+)
+
+// fingerprint identifies the physical receipt behind r, so the same paper
+// receipt submitted twice (by anyone) maps to the same value. Case,
+// surrounding/repeated whitespace and item order are ignored. r must have
+// been through validateReceipt so the cents fields are set.
+func fingerprint(r *models.Receipt) string {
+	items := make([]string, len(r.Items))
+	for i, item := range r.Items {
+		items[i] = fmt.Sprintf("%s=%d", normalizeText(item.ShortDescription), item.PriceCents)
+	}
+	sort.Strings(items)
+
+	canonical := strings.Join([]string{
+		normalizeText(r.Retailer),
+		r.PurchaseDate,
+		r.PurchaseTime,
+		fmt.Sprint(r.TotalCents),
+		strings.Join(items, "|"),
+	}, "\n")
+	sum := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeText lowercases s and collapses runs of whitespace.
+func normalizeText(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
@@ -0,0 +1,85 @@
+package receipt
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/kartikeya55555/fetch-assignment/internal/errors"
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+)
+
+// ReserveIdempotencyKey ties key to r.ID. If key was already used within the
+// idempotency window it returns the original receipt ID and false, or
+// errors.ErrIdempotencyKeyReused if that earlier request had a different body.
+func (s *receiptService) ReserveIdempotencyKey(ctx context.Context, key string, r *models.Receipt) (string, bool, error) {
+	rec := IdempotencyRecord{
+		Key:         key,
+		ReceiptID:   r.ID,
+		RequestHash: requestHash(r),
+		CreatedAt:   time.Now(),
+	}
+	stored, claimed, err := s.store.ClaimIdempotencyKey(ctx, rec, s.idempotencyWindow)
+	if err != nil {
+		return "", false, err
+	}
+	if !claimed && stored.RequestHash != rec.RequestHash {
+		return "", false, errors.ErrIdempotencyKeyReused
+	}
+	return stored.ReceiptID, claimed, nil
+}
+
+// redemptionKeyPrefix keeps redemption keys apart from receipt submission keys.
+const redemptionKeyPrefix = "redemption:"
+
+// ReserveRedemptionKey ties key to the redemption entryID of points by userID,
+// as ReserveIdempotencyKey does for receipts, and returns the original entry
+// ID when the same redemption is retried. Release it with
+// ReleaseIdempotencyKey(ctx, RedemptionKey(key)).
+func (s *receiptService) ReserveRedemptionKey(ctx context.Context, key, userID, entryID string, points int) (string, bool, error) {
+	data, _ := json.Marshal(struct {
+		UserID string `json:"userId"`
+		Points int    `json:"points"`
+	}{userID, points})
+	sum := sha256.Sum256(data)
+	rec := IdempotencyRecord{
+		Key:         RedemptionKey(key),
+		ReceiptID:   entryID,
+		RequestHash: hex.EncodeToString(sum[:]),
+		CreatedAt:   time.Now(),
+	}
+	stored, claimed, err := s.store.ClaimIdempotencyKey(ctx, rec, s.idempotencyWindow)
+	if err != nil {
+		return "", false, err
+	}
+	if !claimed && stored.RequestHash != rec.RequestHash {
+		return "", false, errors.ErrIdempotencyKeyReused
+	}
+	return stored.ReceiptID, claimed, nil
+}
+
+// RedemptionKey is the stored form of a redemption's Idempotency-Key.
+func RedemptionKey(key string) string {
+	return redemptionKeyPrefix + key
+}
+
+func (s *receiptService) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	return s.store.ReleaseIdempotencyKey(ctx, key)
+}
+
+// requestHash identifies the client-supplied part of a receipt and who sent
+// it, ignoring the server-assigned ID and status.
+func requestHash(r *models.Receipt) string {
+	data, _ := json.Marshal(struct {
+		Retailer     string        `json:"retailer"`
+		PurchaseDate string        `json:"purchaseDate"`
+		PurchaseTime string        `json:"purchaseTime"`
+		Total        string        `json:"total"`
+		Items        []models.Item `json:"items"`
+		UserID       string        `json:"userId,omitempty"`
+	}{r.Retailer, r.PurchaseDate, r.PurchaseTime, r.Total, r.Items, r.UserID})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
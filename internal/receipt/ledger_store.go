@@ -0,0 +1,132 @@
+package receipt
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kartikeya55555/fetch-assignment/internal/errors"
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+)
+
+// LedgerStore keeps the append-only points ledger. A user's balance is the
+// sum of their entries.
+type LedgerStore interface {
+	// SettleReceipt appends whatever CREDIT or REVERSAL brings the net points
+	// recorded for receiptID to points, and returns it; nil means the ledger
+	// already matched, so retries never double-credit.
+	SettleReceipt(ctx context.Context, userID, receiptID string, points int) (*models.LedgerEntry, error)
+	// Redeem appends a DEBIT of points with ID entryID, or fails with
+	// errors.ErrInsufficientPoints if the balance is smaller. The check and
+	// the write are atomic, so concurrent redemptions cannot overdraw.
+	Redeem(ctx context.Context, userID, entryID string, points int) (models.LedgerEntry, error)
+	Balance(ctx context.Context, userID string) (int, error)
+	Entries(ctx context.Context, userID string) ([]models.LedgerEntry, error)
+	Close() error
+}
+
+// NewLedgerStore builds the ledger matching NewStore's storeType and path;
+// the SQLite ledger lives in the same database file as the receipts.
+func NewLedgerStore(storeType, path string) (LedgerStore, error) {
+	switch storeType {
+	case "", "memory":
+		return NewInMemoryLedgerStore(), nil
+	case "sqlite":
+		return NewSQLiteLedgerStore(path)
+	default:
+		return nil, fmt.Errorf("unknown store type %q", storeType)
+	}
+}
+
+// settlementKind is the entry kind that moves a receipt's net points by delta.
+func settlementKind(delta int) models.LedgerEntryKind {
+	if delta > 0 {
+		return models.LedgerCredit
+	}
+	return models.LedgerReversal
+}
+
+type inMemoryLedgerStore struct {
+	mu      sync.RWMutex
+	entries []models.LedgerEntry
+}
+
+func NewInMemoryLedgerStore() LedgerStore {
+	return &inMemoryLedgerStore{}
+}
+
+func (s *inMemoryLedgerStore) SettleReceipt(ctx context.Context, userID, receiptID string, points int) (*models.LedgerEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	net := 0
+	for _, e := range s.entries {
+		if e.ReceiptID == receiptID {
+			net += e.Points
+		}
+	}
+	if net == points {
+		return nil, nil
+	}
+	e := models.LedgerEntry{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		ReceiptID: receiptID,
+		Kind:      settlementKind(points - net),
+		Points:    points - net,
+		CreatedAt: time.Now().UTC(),
+	}
+	s.entries = append(s.entries, e)
+	return &e, nil
+}
+
+func (s *inMemoryLedgerStore) Redeem(ctx context.Context, userID, entryID string, points int) (models.LedgerEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.balance(userID) < points {
+		return models.LedgerEntry{}, errors.ErrInsufficientPoints
+	}
+	e := models.LedgerEntry{
+		ID:        entryID,
+		UserID:    userID,
+		Kind:      models.LedgerDebit,
+		Points:    -points,
+		CreatedAt: time.Now().UTC(),
+	}
+	s.entries = append(s.entries, e)
+	return e, nil
+}
+
+func (s *inMemoryLedgerStore) Balance(ctx context.Context, userID string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.balance(userID), nil
+}
+
+// balance sums userID's entries; callers hold s.mu.
+func (s *inMemoryLedgerStore) balance(userID string) int {
+	balance := 0
+	for _, e := range s.entries {
+		if e.UserID == userID {
+			balance += e.Points
+		}
+	}
+	return balance
+}
+
+func (s *inMemoryLedgerStore) Entries(ctx context.Context, userID string) ([]models.LedgerEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var entries []models.LedgerEntry
+	for _, e := range s.entries {
+		if e.UserID == userID {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func (s *inMemoryLedgerStore) Close() error {
+	return nil
+}
@@ -0,0 +1,137 @@
+package receipt
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/kartikeya55555/fetch-assignment/internal/errors"
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// forEachLedger runs fn against every LedgerStore implementation.
+func forEachLedger(t *testing.T, fn func(t *testing.T, ledger LedgerStore)) {
+	t.Run("memory", func(t *testing.T) {
+		fn(t, NewInMemoryLedgerStore())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		ledger, err := NewSQLiteLedgerStore(filepath.Join(t.TempDir(), "receipts.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { ledger.Close() })
+		fn(t, ledger)
+	})
+}
+
+func TestLedger_BalanceSumsUserEntries(t *testing.T) {
+	forEachLedger(t, func(t *testing.T, ledger LedgerStore) {
+		ctx := context.Background()
+		_, err := ledger.SettleReceipt(ctx, "alice", "r1", 28)
+		require.NoError(t, err)
+		_, err = ledger.SettleReceipt(ctx, "alice", "r2", 109)
+		require.NoError(t, err)
+		_, err = ledger.SettleReceipt(ctx, "bob", "r3", 10)
+		require.NoError(t, err)
+
+		balance, err := ledger.Balance(ctx, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, 137, balance)
+
+		entries, err := ledger.Entries(ctx, "alice")
+		require.NoError(t, err)
+		assert.Len(t, entries, 2)
+
+		balance, err = ledger.Balance(ctx, "nobody")
+		require.NoError(t, err)
+		assert.Equal(t, 0, balance)
+	})
+}
+
+func TestLedger_SettleReceipt(t *testing.T) {
+	forEachLedger(t, func(t *testing.T, ledger LedgerStore) {
+		ctx := context.Background()
+		entry, err := ledger.SettleReceipt(ctx, "alice", "r1", 28)
+		require.NoError(t, err)
+		require.NotNil(t, entry)
+		assert.Equal(t, models.LedgerCredit, entry.Kind)
+		assert.Equal(t, 28, entry.Points)
+
+		// A retry finds the ledger already settled
+		entry, err = ledger.SettleReceipt(ctx, "alice", "r1", 28)
+		require.NoError(t, err)
+		assert.Nil(t, entry)
+
+		// Flagged later: the credit is reversed, not deleted
+		entry, err = ledger.SettleReceipt(ctx, "alice", "r1", 0)
+		require.NoError(t, err)
+		require.NotNil(t, entry)
+		assert.Equal(t, models.LedgerReversal, entry.Kind)
+		assert.Equal(t, -28, entry.Points)
+
+		balance, err := ledger.Balance(ctx, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, 0, balance)
+		entries, err := ledger.Entries(ctx, "alice")
+		require.NoError(t, err)
+		assert.Len(t, entries, 2)
+	})
+}
+
+func TestLedger_Redeem(t *testing.T) {
+	forEachLedger(t, func(t *testing.T, ledger LedgerStore) {
+		ctx := context.Background()
+		_, err := ledger.SettleReceipt(ctx, "alice", "r1", 28)
+		require.NoError(t, err)
+
+		entry, err := ledger.Redeem(ctx, "alice", "d1", 20)
+		require.NoError(t, err)
+		assert.Equal(t, models.LedgerDebit, entry.Kind)
+		assert.Equal(t, -20, entry.Points)
+		assert.Equal(t, "d1", entry.ID)
+		assert.Empty(t, entry.ReceiptID)
+
+		_, err = ledger.Redeem(ctx, "alice", "d2", 9)
+		assert.ErrorIs(t, err, errors.ErrInsufficientPoints)
+
+		balance, err := ledger.Balance(ctx, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, 8, balance)
+	})
+}
+
+func TestLedger_ConcurrentRedeemsCannotOverdraw(t *testing.T) {
+	forEachLedger(t, func(t *testing.T, ledger LedgerStore) {
+		ctx := context.Background()
+		_, err := ledger.SettleReceipt(ctx, "alice", "r1", 100)
+		require.NoError(t, err)
+
+		var (
+			wg        sync.WaitGroup
+			mu        sync.Mutex
+			succeeded int
+		)
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := ledger.Redeem(ctx, "alice", uuid.NewString(), 10)
+				if err == nil {
+					mu.Lock()
+					succeeded++
+					mu.Unlock()
+					return
+				}
+				assert.ErrorIs(t, err, errors.ErrInsufficientPoints)
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 10, succeeded)
+		balance, err := ledger.Balance(ctx, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, 0, balance)
+	})
+}
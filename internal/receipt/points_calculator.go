@@ -1,86 +1,107 @@
 package receipt
 
 import (
+	"encoding/json"
+	"fmt"
 	"math"
-	"strconv"
-	"strings"
-	"time"
+	"os"
 
 	"github.com/kartikeya55555/fetch-assignment/internal/models"
 )
 
+// PointsCalculator scores a receipt, returning the total and the
+// per-rule breakdown that adds up to it.
 type PointsCalculator interface {
-	CalculatePoints(r *models.Receipt) int
+	CalculatePoints(r *models.Receipt) (int, []models.PointsEntry)
 }
 
-type defaultPointsCalculator struct{}
-
-func NewDefaultPointsCalculator() PointsCalculator {
-	return &defaultPointsCalculator{}
+// RuleSettings tunes a single rule. Rules missing from a RulesConfig keep
+// the defaults: enabled with weight 1.
+type RuleSettings struct {
+	Enabled *bool    `json:"enabled,omitempty"`
+	Weight  *float64 `json:"weight,omitempty"` // multiplier applied to the rule's points
 }
 
-// CalculatePoints implements the same logic you had before
-func (calc *defaultPointsCalculator) CalculatePoints(r *models.Receipt) int {
-	points := 0
+// RulesConfig is the on-disk format of the points rules file, e.g.
+//
+//	{"rules": {"odd-day": {"enabled": false}, "round-total": {"weight": 2}}}
+type RulesConfig struct {
+	Rules map[string]RuleSettings `json:"rules"`
+}
 
-	// 1) One point per alphanumeric in retailer
-	for _, ch := range r.Retailer {
-		if isAlphanumeric(ch) {
-			points++
-		}
+// LoadRulesConfig reads a RulesConfig from a JSON file.
+func LoadRulesConfig(path string) (RulesConfig, error) {
+	var cfg RulesConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("read rules file: %w", err)
 	}
-
-	totalF, _ := strconv.ParseFloat(r.Total, 64)
-
-	// 2) +50 if total is round dollar
-	if hasNoCents(totalF) {
-		points += 50
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse rules file %s: %w", path, err)
 	}
+	return cfg, nil
+}
 
-	// 3) +25 if total is multiple of 0.25
-	if isMultipleOfQuarter(totalF) {
-		points += 25
-	}
+type weightedRule struct {
+	rule   Rule
+	weight float64
+}
 
-	// 4) +5 points for every 2 items
-	points += (len(r.Items) / 2) * 5
+type rulePointsCalculator struct {
+	rules []weightedRule
+}
 
-	// 5) If desc len %3 == 0 => +ceil(price * 0.2)
-	for _, item := range r.Items {
-		desc := strings.TrimSpace(item.ShortDescription)
-		if len(desc)%3 == 0 {
-			pF, _ := strconv.ParseFloat(item.Price, 64)
-			points += int(math.Ceil(pF * 0.2))
-		}
-	}
+// NewDefaultPointsCalculator scores receipts with every built-in rule at
+// its standard weight.
+func NewDefaultPointsCalculator() PointsCalculator {
+	calc, _ := NewRulePointsCalculator(RulesConfig{})
+	return calc
+}
 
-	// 6) +6 if purchase day is odd
-	d, _ := time.Parse("2006-01-02", r.PurchaseDate)
-	if d.Day()%2 == 1 {
-		points += 6
+// NewRulePointsCalculator composes the built-in rules according to cfg.
+// Naming a rule that doesn't exist is an error so typos don't go unnoticed.
+func NewRulePointsCalculator(cfg RulesConfig) (PointsCalculator, error) {
+	known := make(map[string]bool, len(defaultRules))
+	for _, rule := range defaultRules {
+		known[rule.Name()] = true
 	}
-
-	// 7) +10 if purchase time is after 2pm and before 4pm
-	t, _ := time.Parse("15:04", r.PurchaseTime)
-	if t.Hour() == 14 && t.Minute() > 0 || (t.Hour() > 14 && t.Hour() < 16) {
-		points += 10
+	for name := range cfg.Rules {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown points rule %q", name)
+		}
 	}
 
-	return points
-}
-
-// Helpers
-func isAlphanumeric(ch rune) bool {
-	return (ch >= '0' && ch <= '9') ||
-		(ch >= 'a' && ch <= 'z') ||
-		(ch >= 'A' && ch <= 'Z')
-}
-
-func hasNoCents(f float64) bool {
-	return f == float64(int64(f))
+	calc := &rulePointsCalculator{}
+	for _, rule := range defaultRules {
+		settings := cfg.Rules[rule.Name()]
+		if settings.Enabled != nil && !*settings.Enabled {
+			continue
+		}
+		weight := 1.0
+		if settings.Weight != nil {
+			weight = *settings.Weight
+		}
+		calc.rules = append(calc.rules, weightedRule{rule: rule, weight: weight})
+	}
+	return calc, nil
 }
 
-func isMultipleOfQuarter(f float64) bool {
-	rem := math.Mod(f, 0.25)
-	return math.Abs(rem) < 1e-9
+// CalculatePoints sums the points of every enabled rule
+func (calc *rulePointsCalculator) CalculatePoints(r *models.Receipt) (int, []models.PointsEntry) {
+	total := 0
+	breakdown := make([]models.PointsEntry, 0, len(calc.rules))
+	for _, wr := range calc.rules {
+		points, reason := wr.rule.Points(r)
+		if wr.weight != 1 {
+			points = int(math.Round(float64(points) * wr.weight))
+			reason = fmt.Sprintf("%s (weight %g)", reason, wr.weight)
+		}
+		total += points
+		breakdown = append(breakdown, models.PointsEntry{
+			Rule:   wr.rule.Name(),
+			Points: points,
+			Reason: reason,
+		})
+	}
+	return total, breakdown
 }
@@ -0,0 +1,86 @@
+package receipt
+
+import (
+	"testing"
+
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validated runs validateReceipt, which the rules depend on for cents.
+func validated(t *testing.T, r *models.Receipt) *models.Receipt {
+	t.Helper()
+	require.Empty(t, validateReceipt(r))
+	return r
+}
+
+func targetReceipt() *models.Receipt {
+	return &models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Total:        "35.35",
+		Items: []models.Item{
+			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
+			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
+			{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
+			{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
+			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00"},
+		},
+	}
+}
+
+func mmReceipt() *models.Receipt {
+	return &models.Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: "2022-03-20",
+		PurchaseTime: "14:33",
+		Total:        "9.00",
+		Items: []models.Item{
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+		},
+	}
+}
+
+func TestDefaultPointsCalculator(t *testing.T) {
+	calc := NewDefaultPointsCalculator()
+
+	points, _ := calc.CalculatePoints(validated(t, targetReceipt()))
+	assert.Equal(t, 28, points)
+
+	points, breakdown := calc.CalculatePoints(validated(t, mmReceipt()))
+	assert.Equal(t, 109, points)
+	assert.Len(t, breakdown, len(defaultRules))
+
+	sum := 0
+	for _, entry := range breakdown {
+		assert.NotEmpty(t, entry.Reason, "rule %s should explain itself", entry.Rule)
+		sum += entry.Points
+	}
+	assert.Equal(t, points, sum)
+}
+
+func TestRulePointsCalculator_DisableAndReweight(t *testing.T) {
+	disabled, weight := false, 2.0
+	calc, err := NewRulePointsCalculator(RulesConfig{Rules: map[string]RuleSettings{
+		"round-total":      {Enabled: &disabled},
+		"afternoon-window": {Weight: &weight},
+	}})
+	require.NoError(t, err)
+
+	// 109 - 50 (round-total) + 10 (afternoon-window doubled)
+	points, breakdown := calc.CalculatePoints(validated(t, mmReceipt()))
+	assert.Equal(t, 69, points)
+	assert.Len(t, breakdown, len(defaultRules)-1)
+}
+
+func TestRulePointsCalculator_UnknownRule(t *testing.T) {
+	_, err := NewRulePointsCalculator(RulesConfig{Rules: map[string]RuleSettings{
+		"lucky-number": {},
+	}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,192 @@
+package receipt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kartikeya55555/fetch-assignment/internal/errors"
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+)
+
+// Sort fields accepted by ReceiptQuery.SortBy
+const (
+	SortByPurchaseDate = "purchaseDate"
+	SortByPoints       = "points"
+	SortByRetailer     = "retailer"
+)
+
+// ReceiptQuery filters, sorts and pages ListReceipts results. Zero values
+// mean "no filter".
+type ReceiptQuery struct {
+	UserID       string               // exact match
+	Retailer     string               // case-insensitive substring match
+	Status       models.ReceiptStatus // exact match
+	PurchasedGTE string               // purchaseDate >= (YYYY-MM-DD)
+	PurchasedLTE string               // purchaseDate <= (YYYY-MM-DD)
+	MinPoints    *int
+	MaxPoints    *int
+
+	SortBy     string // one of the SortBy* constants, default purchaseDate
+	Descending bool
+	Limit      int    // page size, 1-100 (default 20)
+	Cursor     string // NextCursor of the previous page
+}
+
+// ReceiptPage is one page of ListReceipts results.
+type ReceiptPage struct {
+	Receipts   []*models.Receipt `json:"receipts"`
+	NextCursor string            `json:"nextCursor,omitempty"` // empty on the last page
+}
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// cursor is the position after the last receipt of a page: its sort key and
+// ID (the tie-breaker), so pages stay stable while receipts are added.
+type cursor struct {
+	SortBy string `json:"s"`
+	Desc   bool   `json:"d"`
+	Key    string `json:"k"`
+	Points int    `json:"p"`
+	ID     string `json:"i"`
+}
+
+// normalize applies defaults and rejects invalid queries.
+func (q *ReceiptQuery) normalize() error {
+	switch q.SortBy {
+	case "":
+		q.SortBy = SortByPurchaseDate
+	case SortByPurchaseDate, SortByPoints, SortByRetailer:
+	default:
+		return fmt.Errorf("%w: unknown sort field %q", errors.ErrInvalidQuery, q.SortBy)
+	}
+	if q.Status != "" && !q.Status.IsValid() {
+		return fmt.Errorf("%w: unknown status %q", errors.ErrInvalidQuery, q.Status)
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultPageSize
+	}
+	if q.Limit < 1 || q.Limit > maxPageSize {
+		return fmt.Errorf("%w: limit must be between 1 and %d", errors.ErrInvalidQuery, maxPageSize)
+	}
+	return nil
+}
+
+func (q *ReceiptQuery) matches(r *models.Receipt) bool {
+	if q.UserID != "" && r.UserID != q.UserID {
+		return false
+	}
+	if q.Retailer != "" && !strings.Contains(strings.ToLower(r.Retailer), strings.ToLower(q.Retailer)) {
+		return false
+	}
+	if q.Status != "" && r.Status != q.Status {
+		return false
+	}
+	if q.PurchasedGTE != "" && r.PurchaseDate < q.PurchasedGTE {
+		return false
+	}
+	if q.PurchasedLTE != "" && r.PurchaseDate > q.PurchasedLTE {
+		return false
+	}
+	if q.MinPoints != nil && r.Points < *q.MinPoints {
+		return false
+	}
+	if q.MaxPoints != nil && r.Points > *q.MaxPoints {
+		return false
+	}
+	return true
+}
+
+// cursorFor returns the position of r in q's ordering.
+func (q *ReceiptQuery) cursorFor(r *models.Receipt) cursor {
+	c := cursor{SortBy: q.SortBy, Desc: q.Descending, ID: r.ID}
+	switch q.SortBy {
+	case SortByPoints:
+		c.Points = r.Points
+	case SortByRetailer:
+		c.Key = strings.ToLower(r.Retailer)
+	default:
+		c.Key = r.PurchaseDate
+	}
+	return c
+}
+
+// compare orders two positions ascending by sort key, then ID.
+func compare(a, b cursor) int {
+	if a.Points != b.Points {
+		if a.Points < b.Points {
+			return -1
+		}
+		return 1
+	}
+	if c := strings.Compare(a.Key, b.Key); c != 0 {
+		return c
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// applyQuery filters, sorts and pages receipts. Stores without native query
+// support load candidate receipts and hand them to this.
+func applyQuery(receipts []*models.Receipt, q ReceiptQuery) (ReceiptPage, error) {
+	if err := q.normalize(); err != nil {
+		return ReceiptPage{}, err
+	}
+
+	var after *cursor
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil || c.SortBy != q.SortBy || c.Desc != q.Descending {
+			return ReceiptPage{}, fmt.Errorf("%w: cursor does not match this query", errors.ErrInvalidQuery)
+		}
+		after = &c
+	}
+
+	// less respects the requested direction; IDs break ties the same way
+	less := func(a, b cursor) bool {
+		if q.Descending {
+			return compare(a, b) > 0
+		}
+		return compare(a, b) < 0
+	}
+
+	matched := make([]*models.Receipt, 0, len(receipts))
+	for _, r := range receipts {
+		if !q.matches(r) {
+			continue
+		}
+		if after != nil && !less(*after, q.cursorFor(r)) {
+			continue
+		}
+		matched = append(matched, r)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return less(q.cursorFor(matched[i]), q.cursorFor(matched[j]))
+	})
+
+	page := ReceiptPage{Receipts: matched}
+	if len(matched) > q.Limit {
+		page.Receipts = matched[:q.Limit]
+		page.NextCursor = encodeCursor(q.cursorFor(page.Receipts[q.Limit-1]))
+	}
+	return page, nil
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
@@ -0,0 +1,100 @@
+package receipt
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/kartikeya55555/fetch-assignment/internal/errors"
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seedReceipts(t *testing.T, store ReceiptStore) {
+	t.Helper()
+	ctx := context.Background()
+	for i := 1; i <= 5; i++ {
+		status := models.StatusCompleted
+		if i == 5 {
+			status = models.StatusPending
+		}
+		require.NoError(t, store.AddReceipt(ctx, &models.Receipt{
+			ID:           fmt.Sprintf("r%d", i),
+			Status:       status,
+			Retailer:     []string{"Target", "Walmart"}[i%2],
+			PurchaseDate: fmt.Sprintf("2022-01-%02d", i),
+			Points:       i * 10,
+		}))
+	}
+}
+
+func ids(page ReceiptPage) []string {
+	out := make([]string, len(page.Receipts))
+	for i, r := range page.Receipts {
+		out[i] = r.ID
+	}
+	return out
+}
+
+func TestStore_ListReceipts_Filters(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store ReceiptStore) {
+		seedReceipts(t, store)
+		ctx := context.Background()
+		minPoints, maxPoints := 20, 40
+
+		page, err := store.ListReceipts(ctx, ReceiptQuery{
+			Retailer:  "walMART",
+			Status:    models.StatusCompleted,
+			MinPoints: &minPoints,
+			MaxPoints: &maxPoints,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"r3"}, ids(page))
+
+		page, err = store.ListReceipts(ctx, ReceiptQuery{PurchasedGTE: "2022-01-02", PurchasedLTE: "2022-01-03"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"r2", "r3"}, ids(page))
+	})
+}
+
+func TestStore_ListReceipts_Pagination(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store ReceiptStore) {
+		seedReceipts(t, store)
+		ctx := context.Background()
+		q := ReceiptQuery{SortBy: SortByPoints, Descending: true, Limit: 2}
+
+		var got []string
+		for {
+			page, err := store.ListReceipts(ctx, q)
+			require.NoError(t, err)
+			got = append(got, ids(page)...)
+			if page.NextCursor == "" {
+				break
+			}
+			q.Cursor = page.NextCursor
+		}
+		assert.Equal(t, []string{"r5", "r4", "r3", "r2", "r1"}, got)
+	})
+}
+
+func TestStore_ListReceipts_InvalidQuery(t *testing.T) {
+	store := NewInMemoryStore()
+	ctx := context.Background()
+
+	_, err := store.ListReceipts(ctx, ReceiptQuery{SortBy: "total"})
+	assert.ErrorIs(t, err, errors.ErrInvalidQuery)
+
+	_, err = store.ListReceipts(ctx, ReceiptQuery{Limit: 1000})
+	assert.ErrorIs(t, err, errors.ErrInvalidQuery)
+
+	_, err = store.ListReceipts(ctx, ReceiptQuery{Status: "COMPLETE"})
+	assert.ErrorIs(t, err, errors.ErrInvalidQuery)
+
+	// A cursor from a differently sorted query is rejected
+	seedReceipts(t, store)
+	page, err := store.ListReceipts(ctx, ReceiptQuery{SortBy: SortByPoints, Limit: 1})
+	require.NoError(t, err)
+	_, err = store.ListReceipts(ctx, ReceiptQuery{Cursor: page.NextCursor})
+	assert.ErrorIs(t, err, errors.ErrInvalidQuery)
+}
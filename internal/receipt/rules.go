@@ -0,0 +1,108 @@
+package receipt
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+)
+
+// Rule is one independently configurable part of the points calculation.
+// Points also returns a human-readable reason, including when the rule
+// awards nothing, so support staff can explain a receipt's total.
+type Rule interface {
+	Name() string
+	Points(r *models.Receipt) (int, string)
+}
+
+// ruleFunc adapts a plain function to the Rule interface.
+type ruleFunc struct {
+	name string
+	fn   func(r *models.Receipt) (int, string)
+}
+
+func (f ruleFunc) Name() string                           { return f.name }
+func (f ruleFunc) Points(r *models.Receipt) (int, string) { return f.fn(r) }
+
+// defaultRules are the built-in rules in evaluation order. Rules files
+// refer to them by name. Money rules use the cents fields that
+// validateReceipt fills in, never the raw strings.
+var defaultRules = []Rule{
+	// One point per alphanumeric in retailer
+	ruleFunc{"retailer-name", func(r *models.Receipt) (int, string) {
+		points := 0
+		for _, ch := range r.Retailer {
+			if isAlphanumeric(ch) {
+				points++
+			}
+		}
+		return points, fmt.Sprintf("%d alphanumeric characters in retailer name %q", points, r.Retailer)
+	}},
+
+	// +50 if total is round dollar
+	ruleFunc{"round-total", func(r *models.Receipt) (int, string) {
+		if r.TotalCents%100 == 0 {
+			return 50, fmt.Sprintf("total %s is a round dollar amount", r.Total)
+		}
+		return 0, fmt.Sprintf("total %s has cents", r.Total)
+	}},
+
+	// +25 if total is multiple of 0.25
+	ruleFunc{"quarter-multiple", func(r *models.Receipt) (int, string) {
+		if r.TotalCents%25 == 0 {
+			return 25, fmt.Sprintf("total %s is a multiple of 0.25", r.Total)
+		}
+		return 0, fmt.Sprintf("total %s is not a multiple of 0.25", r.Total)
+	}},
+
+	// +5 points for every 2 items
+	ruleFunc{"item-pairs", func(r *models.Receipt) (int, string) {
+		pairs := len(r.Items) / 2
+		return pairs * 5, fmt.Sprintf("%d items make %d pairs, 5 points each", len(r.Items), pairs)
+	}},
+
+	// If desc len %3 == 0 => +ceil(price * 0.2)
+	ruleFunc{"description-length", func(r *models.Receipt) (int, string) {
+		points := 0
+		var reasons []string
+		for _, item := range r.Items {
+			desc := strings.TrimSpace(item.ShortDescription)
+			if len(desc)%3 == 0 {
+				// ceil(price * 0.2) == ceil(cents / 500), done in integers
+				p := int((item.PriceCents + 499) / 500)
+				points += p
+				reasons = append(reasons, fmt.Sprintf("%q has length %d, ceil(%s * 0.2) = %d", desc, len(desc), item.Price, p))
+			}
+		}
+		if len(reasons) == 0 {
+			return 0, "no trimmed item description length is a multiple of 3"
+		}
+		return points, strings.Join(reasons, "; ")
+	}},
+
+	// +6 if purchase day is odd
+	ruleFunc{"odd-day", func(r *models.Receipt) (int, string) {
+		d, _ := time.Parse("2006-01-02", r.PurchaseDate)
+		if d.Day()%2 == 1 {
+			return 6, fmt.Sprintf("purchase day %d is odd", d.Day())
+		}
+		return 0, fmt.Sprintf("purchase day %d is even", d.Day())
+	}},
+
+	// +10 if purchase time is after 2pm and before 4pm
+	ruleFunc{"afternoon-window", func(r *models.Receipt) (int, string) {
+		t, _ := time.Parse("15:04", r.PurchaseTime)
+		if t.Hour() == 14 && t.Minute() > 0 || (t.Hour() > 14 && t.Hour() < 16) {
+			return 10, fmt.Sprintf("purchase time %s is after 2:00pm and before 4:00pm", r.PurchaseTime)
+		}
+		return 0, fmt.Sprintf("purchase time %s is outside 2:00pm-4:00pm", r.PurchaseTime)
+	}},
+}
+
+// Helpers
+func isAlphanumeric(ch rune) bool {
+	return (ch >= '0' && ch <= '9') ||
+		(ch >= 'a' && ch <= 'z') ||
+		(ch >= 'A' && ch <= 'Z')
+}
@@ -1,82 +1,342 @@
 package receipt
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"strings"
+	"log/slog"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/kartikeya55555/fetch-assignment/internal/errors"
+	"github.com/kartikeya55555/fetch-assignment/internal/logging"
 	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	"github.com/kartikeya55555/fetch-assignment/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ReceiptService interface
 type ReceiptService interface {
-	ProcessReceipt(r *models.Receipt) (string, error)
-	GetPoints(id string) (int, error)
-	GetReceipt(id string) (*models.Receipt, error)
-	StorePendingReceipt(r *models.Receipt) error
+	ProcessReceipt(ctx context.Context, r *models.Receipt) (string, error)
+	GetPoints(ctx context.Context, id string) (int, error)
+	GetReceipt(ctx context.Context, id string) (*models.Receipt, error)
+	ListReceipts(ctx context.Context, q ReceiptQuery) (ReceiptPage, error)
+	StorePendingReceipt(ctx context.Context, r *models.Receipt) error
+	FailPendingReceipt(ctx context.Context, r *models.Receipt, reason string) error
+	ValidateReceipt(r *models.Receipt) []models.FieldError
+	ReprocessReceipt(ctx context.Context, id string) (*models.Receipt, error)
+	FlagReceipt(ctx context.Context, id, reason string) (*models.Receipt, error)
+	ReserveIdempotencyKey(ctx context.Context, key string, r *models.Receipt) (string, bool, error)
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+	GetUserPoints(ctx context.Context, userID string) (int, error)
+	GetUserLedger(ctx context.Context, userID string) ([]models.LedgerEntry, error)
+	RedeemPoints(ctx context.Context, userID, entryID string, points int) (models.LedgerEntry, error)
+	ReserveRedemptionKey(ctx context.Context, key, userID, entryID string, points int) (string, bool, error)
+	ListUserReceipts(ctx context.Context, userID string, q ReceiptQuery) (ReceiptPage, error)
 }
 
+// DefaultIdempotencyWindow is how long an Idempotency-Key is remembered
+// unless WithIdempotencyWindow says otherwise.
+const DefaultIdempotencyWindow = 24 * time.Hour
+
 type receiptService struct {
-	store ReceiptStore
-	calc  PointsCalculator
+	store             ReceiptStore
+	calc              PointsCalculator
+	ledger            LedgerStore
+	idempotencyWindow time.Duration
+	logger            *slog.Logger
+}
+
+// Option customizes a ReceiptService.
+type Option func(*receiptService)
+
+// WithIdempotencyWindow sets how long repeated Idempotency-Keys return the
+// original receipt.
+func WithIdempotencyWindow(d time.Duration) Option {
+	return func(s *receiptService) {
+		s.idempotencyWindow = d
+	}
+}
+
+// WithLogger sets where the service logs. Without it the service uses
+// slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *receiptService) {
+		s.logger = logger
+	}
 }
 
-func NewReceiptService(store ReceiptStore, calc PointsCalculator) ReceiptService {
-	return &receiptService{
-		store: store,
-		calc:  calc,
+// WithLedger sets where users' points are credited. Without it the service
+// keeps an in-memory ledger.
+func WithLedger(ledger LedgerStore) Option {
+	return func(s *receiptService) {
+		s.ledger = ledger
 	}
 }
 
+func NewReceiptService(store ReceiptStore, calc PointsCalculator, opts ...Option) ReceiptService {
+	s := &receiptService{
+		store:             store,
+		calc:              calc,
+		ledger:            NewInMemoryLedgerStore(),
+		idempotencyWindow: DefaultIdempotencyWindow,
+		logger:            slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
 // If the API wants to store a pending record:
-func (s *receiptService) StorePendingReceipt(r *models.Receipt) error {
+func (s *receiptService) StorePendingReceipt(ctx context.Context, r *models.Receipt) error {
 	if r.ID == "" {
 		r.ID = uuid.NewString()
 	}
 	if r.Status == "" {
-		r.Status = "PENDING"
+		r.Status = models.StatusPending
 	}
-	return s.store.AddReceipt(r)
+	return s.store.AddReceipt(ctx, r)
+}
+
+// FailPendingReceipt marks a PENDING receipt the API could not enqueue as
+// FAILED, so it doesn't wait for a worker forever. Like any finished receipt
+// it can be reprocessed.
+func (s *receiptService) FailPendingReceipt(ctx context.Context, r *models.Receipt, reason string) error {
+	r.Status = models.StatusFailed
+	r.ErrorMessage = reason
+	return s.store.UpdateReceipt(ctx, r, models.StatusPending)
+}
+
+// API calls this before enqueueing; the worker re-checks everything
+func (s *receiptService) ValidateReceipt(r *models.Receipt) []models.FieldError {
+	return ValidateStructure(r)
 }
 
-// Worker calls this to do heavy-lifting validations
-func (s *receiptService) ProcessReceipt(r *models.Receipt) (string, error) {
-	log.Printf("[Service] Starting ProcessReceipt for ID=%s (current status=%s)\n", r.ID, r.Status)
+// Worker calls this to do heavy-lifting validations. Every status change goes
+// through UpdateReceipt, so a duplicate or late message for a receipt that is
+// already finished fails with errors.ErrInvalidStatusTransition instead of
+// overwriting it.
+func (s *receiptService) ProcessReceipt(ctx context.Context, r *models.Receipt) (id string, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ReceiptService.ProcessReceipt",
+		trace.WithAttributes(attribute.String("receipt.id", r.ID)))
+	defer func() {
+		span.SetAttributes(attribute.String("receipt.status", string(r.Status)), attribute.Int("receipt.points", r.Points))
+		tracing.End(span, err)
+	}()
+
+	ctx = logging.With(ctx, slog.String("receipt_id", r.ID))
+	s.logger.DebugContext(ctx, "Processing receipt", "status", r.Status)
+
+	// Claim the receipt: PENDING -> PROCESSING
+	current, found := s.store.GetReceipt(ctx, r.ID)
+	if !found {
+		// The API stores receipts before enqueueing; recreate the record if the
+		// store lost it. GetReceipt also misses on read errors, so only insert:
+		// an existing receipt must not be reset to PENDING and scored again.
+		r.Status = models.StatusPending
+		created, err := s.store.CreateReceipt(ctx, r)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Store CreateReceipt failed", "error", err)
+			return "", err
+		}
+		current = r
+		if !created {
+			if current, found = s.store.GetReceipt(ctx, r.ID); !found {
+				// Not ErrInvalidStatusTransition, so the message is retried
+				return "", fmt.Errorf("[Service] cannot read receipt %s", r.ID)
+			}
+		}
+	}
+	from := current.Status
+	r.Status = models.StatusProcessing
+	if err := s.store.UpdateReceipt(ctx, r, from); err != nil {
+		return "", fmt.Errorf("[Service] cannot process receipt %s in status %s: %w", r.ID, from, err)
+	}
+
 	issues := validateReceipt(r)
 	if len(issues) > 0 {
-		r.Status = "FAILED"
-		r.ErrorMessage = strings.Join(issues, "; ")
-		s.store.AddReceipt(r)
-		log.Printf("[Service] Validation FAILED for ID=%s => %s\n", r.ID, r.ErrorMessage)
-		return "", fmt.Errorf("[Service] receipt validation failed: %s", r.ErrorMessage)
+		r.Status = models.StatusFailed
+		r.ErrorMessage = joinFieldErrors(issues)
+		r.ValidationErrors = issues
+		r.Points, r.Breakdown = 0, nil
+		if err := s.settleUser(ctx, r); err != nil {
+			s.logger.ErrorContext(ctx, "Ledger SettleReceipt failed", "error", err)
+			return "", err
+		}
+		if err := s.store.UpdateReceipt(ctx, r, models.StatusProcessing); err != nil {
+			s.logger.ErrorContext(ctx, "Store UpdateReceipt failed", "error", err)
+			return "", err
+		}
+		s.logger.InfoContext(ctx, "Receipt failed validation", "fields", FailedFields(issues))
+		return "", fmt.Errorf("[Service] %w: %s", errors.ErrReceiptValidation, r.ErrorMessage)
+	}
+
+	// The same physical receipt only earns points once, whoever submits it
+	r.Fingerprint = fingerprint(r)
+	firstID, err := s.store.ClaimFingerprint(ctx, r.Fingerprint, r.ID)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Store ClaimFingerprint failed", "error", err)
+		return "", err
+	}
+	if firstID != r.ID {
+		r.Status = models.StatusFlagged
+		r.ErrorMessage = ""
+		r.ValidationErrors = nil
+		r.FlagReason = fmt.Sprintf("duplicate of receipt %s", firstID)
+		r.Points, r.Breakdown = 0, nil
+		// Takes back anything credited when this receipt last completed
+		if err := s.settleUser(ctx, r); err != nil {
+			s.logger.ErrorContext(ctx, "Ledger SettleReceipt failed", "error", err)
+			return "", err
+		}
+		if err := s.store.UpdateReceipt(ctx, r, models.StatusProcessing); err != nil {
+			s.logger.ErrorContext(ctx, "Store UpdateReceipt failed", "error", err)
+			return "", err
+		}
+		s.logger.InfoContext(ctx, "Receipt flagged as duplicate", "duplicate_of", firstID)
+		return r.ID, nil
 	}
 
-	r.Status = "COMPLETED"
+	r.Status = models.StatusCompleted
 	r.ErrorMessage = ""
-	r.Points = s.calc.CalculatePoints(r)
-	if err := s.store.AddReceipt(r); err != nil {
-		log.Printf("[Service] Store AddReceipt error: %v\n", err)
+	r.ValidationErrors = nil
+	r.FlagReason = ""
+	r.Points, r.Breakdown = s.calc.CalculatePoints(r)
+
+	// Settle before completing: if the ledger write fails the message is
+	// retried, whereas a retry after COMPLETED would be skipped as stale
+	if err := s.settleUser(ctx, r); err != nil {
+		s.logger.ErrorContext(ctx, "Ledger SettleReceipt failed", "error", err)
+		return "", err
+	}
+	if err := s.store.UpdateReceipt(ctx, r, models.StatusProcessing); err != nil {
+		s.logger.ErrorContext(ctx, "Store UpdateReceipt failed", "error", err)
 		return "", err
 	}
 
-	log.Printf("[Service] Completed ProcessReceipt => ID=%s, Status=%s, Points=%d\n", r.ID, r.Status, r.Points)
+	s.logger.InfoContext(ctx, "Receipt completed", "points", r.Points)
 	return r.ID, nil
 }
 
-func (s *receiptService) GetPoints(id string) (int, error) {
-	rec, found := s.store.GetReceipt(id)
+// ReprocessReceipt moves a finished receipt back to PENDING, clearing its
+// previous outcome, so it can be queued again.
+func (s *receiptService) ReprocessReceipt(ctx context.Context, id string) (*models.Receipt, error) {
+	rec, found := s.store.GetReceipt(ctx, id)
+	if !found {
+		return nil, errors.ErrReceiptNotExist
+	}
+	from := rec.Status
+	rec.Status = models.StatusPending
+	rec.ErrorMessage = ""
+	rec.ValidationErrors = nil
+	rec.FlagReason = ""
+	rec.Points, rec.Breakdown = 0, nil
+	if err := s.store.UpdateReceipt(ctx, rec, from); err != nil {
+		return nil, err
+	}
+	s.logger.InfoContext(ctx, "Receipt reset for reprocessing", "receipt_id", rec.ID, "from", from)
+	return rec, nil
+}
+
+// FlagReceipt flags a COMPLETED receipt found to be fraudulent or wrong after
+// it was scored, and reverses the points it credited. Reprocessing it scores
+// it afresh.
+func (s *receiptService) FlagReceipt(ctx context.Context, id, reason string) (*models.Receipt, error) {
+	rec, found := s.store.GetReceipt(ctx, id)
+	if !found {
+		return nil, errors.ErrReceiptNotExist
+	}
+	if rec.Status != models.StatusCompleted {
+		return nil, errors.ErrInvalidStatusTransition
+	}
+	points := rec.Points
+	rec.Status = models.StatusFlagged
+	rec.FlagReason = reason
+	rec.Points, rec.Breakdown = 0, nil
+
+	// Settle first, as ProcessReceipt does
+	if err := s.settleUser(ctx, rec); err != nil {
+		s.logger.ErrorContext(ctx, "Ledger SettleReceipt failed", "receipt_id", id, "error", err)
+		return nil, err
+	}
+	if err := s.store.UpdateReceipt(ctx, rec, models.StatusCompleted); err != nil {
+		// Changed under us, e.g. reprocessed: put the credit back
+		restored := *rec
+		restored.Points = points
+		if err := s.settleUser(ctx, &restored); err != nil {
+			s.logger.ErrorContext(ctx, "Ledger SettleReceipt failed", "receipt_id", id, "error", err)
+		}
+		return nil, err
+	}
+	s.logger.InfoContext(ctx, "Receipt flagged", "receipt_id", id, "reversed_points", points)
+	return rec, nil
+}
+
+func (s *receiptService) GetPoints(ctx context.Context, id string) (int, error) {
+	rec, found := s.store.GetReceipt(ctx, id)
 	if !found {
 		return 0, errors.ErrReceiptNotExist
 	}
 	return rec.Points, nil
 }
 
-func (s *receiptService) GetReceipt(id string) (*models.Receipt, error) {
-	rec, found := s.store.GetReceipt(id)
+func (s *receiptService) GetReceipt(ctx context.Context, id string) (*models.Receipt, error) {
+	rec, found := s.store.GetReceipt(ctx, id)
 	if !found {
 		return nil, errors.ErrReceiptNotExist
 	}
 	return rec, nil
 }
+
+func (s *receiptService) ListReceipts(ctx context.Context, q ReceiptQuery) (ReceiptPage, error) {
+	return s.store.ListReceipts(ctx, q)
+}
+
+// settleUser brings the ledger in line with r's outcome: a completed receipt
+// nets its points, any other outcome nets zero. Receipts without a user earn
+// points but are not credited to anyone.
+func (s *receiptService) settleUser(ctx context.Context, r *models.Receipt) error {
+	if r.UserID == "" {
+		return nil
+	}
+	entry, err := s.ledger.SettleReceipt(ctx, r.UserID, r.ID, r.Points)
+	if err != nil {
+		return err
+	}
+	if entry != nil {
+		s.logger.InfoContext(ctx, "Ledger entry written", "user_id", r.UserID, "kind", entry.Kind, "points", entry.Points)
+	}
+	return nil
+}
+
+// GetUserPoints returns the user's points balance; users with no credited
+// receipts have a balance of 0.
+func (s *receiptService) GetUserPoints(ctx context.Context, userID string) (int, error) {
+	return s.ledger.Balance(ctx, userID)
+}
+
+// GetUserLedger returns the user's ledger entries, oldest first.
+func (s *receiptService) GetUserLedger(ctx context.Context, userID string) ([]models.LedgerEntry, error) {
+	return s.ledger.Entries(ctx, userID)
+}
+
+// RedeemPoints spends points from the user's balance as the DEBIT entryID,
+// failing with errors.ErrInsufficientPoints rather than letting it go
+// negative.
+func (s *receiptService) RedeemPoints(ctx context.Context, userID, entryID string, points int) (models.LedgerEntry, error) {
+	if points <= 0 {
+		return models.LedgerEntry{}, errors.ErrInvalidRedemption
+	}
+	entry, err := s.ledger.Redeem(ctx, userID, entryID, points)
+	if err != nil {
+		return models.LedgerEntry{}, err
+	}
+	s.logger.InfoContext(ctx, "Ledger entry written", "user_id", userID, "kind", entry.Kind, "points", entry.Points)
+	return entry, nil
+}
+
+func (s *receiptService) ListUserReceipts(ctx context.Context, userID string, q ReceiptQuery) (ReceiptPage, error) {
+	q.UserID = userID
+	return s.store.ListReceipts(ctx, q)
+}
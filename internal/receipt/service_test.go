@@ -0,0 +1,254 @@
+package receipt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kartikeya55555/fetch-assignment/internal/errors"
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessReceipt_FlagsDuplicates(t *testing.T) {
+	ctx := context.Background()
+	service := NewReceiptService(NewInMemoryStore(), NewDefaultPointsCalculator())
+
+	first := targetReceipt()
+	first.ID = "first"
+	_, err := service.ProcessReceipt(ctx, first)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCompleted, first.Status)
+	assert.Equal(t, 28, first.Points)
+
+	// Same paper receipt, different casing, spacing and item order
+	dup := targetReceipt()
+	dup.ID = "dup"
+	dup.Retailer = "  TARGET "
+	dup.Items[0], dup.Items[1] = dup.Items[1], dup.Items[0]
+	_, err = service.ProcessReceipt(ctx, dup)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusFlagged, dup.Status)
+	assert.Equal(t, 0, dup.Points)
+	assert.Contains(t, dup.FlagReason, "first")
+
+	// Once reprocessed, the original is not a duplicate of itself
+	_, err = service.ReprocessReceipt(ctx, "first")
+	require.NoError(t, err)
+	again := targetReceipt()
+	again.ID = "first"
+	_, err = service.ProcessReceipt(ctx, again)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCompleted, again.Status)
+}
+
+func TestProcessReceipt_LateRedeliveryCannotOverwrite(t *testing.T) {
+	ctx := context.Background()
+	service := NewReceiptService(NewInMemoryStore(), NewDefaultPointsCalculator())
+
+	r := targetReceipt()
+	r.ID = "r1"
+	_, err := service.ProcessReceipt(ctx, r)
+	require.NoError(t, err)
+
+	// A stale message whose contents would now fail validation
+	late := targetReceipt()
+	late.ID = "r1"
+	late.PurchaseDate = ""
+	_, err = service.ProcessReceipt(ctx, late)
+	assert.ErrorIs(t, err, errors.ErrInvalidStatusTransition)
+
+	stored, err := service.GetReceipt(ctx, "r1")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCompleted, stored.Status)
+	assert.Equal(t, 28, stored.Points)
+}
+
+// flakyReads misses the next failReads GetReceipt calls, as the SQLite store
+// does on a read error.
+type flakyReads struct {
+	ReceiptStore
+	failReads int
+}
+
+func (s *flakyReads) GetReceipt(ctx context.Context, id string) (*models.Receipt, bool) {
+	if s.failReads > 0 {
+		s.failReads--
+		return nil, false
+	}
+	return s.ReceiptStore.GetReceipt(ctx, id)
+}
+
+func TestProcessReceipt_ReadErrorCannotResetCompleted(t *testing.T) {
+	ctx := context.Background()
+	store := &flakyReads{ReceiptStore: NewInMemoryStore()}
+	service := NewReceiptService(store, NewDefaultPointsCalculator())
+
+	r := targetReceipt()
+	r.ID = "r1"
+	_, err := service.ProcessReceipt(ctx, r)
+	require.NoError(t, err)
+
+	// The redelivery's first read fails, the re-read after the insert finds
+	// the completed receipt: the message is stale
+	store.failReads = 1
+	again := targetReceipt()
+	again.ID = "r1"
+	_, err = service.ProcessReceipt(ctx, again)
+	assert.ErrorIs(t, err, errors.ErrInvalidStatusTransition)
+
+	// Both reads fail: retried later rather than dropped or rescored
+	store.failReads = 2
+	again = targetReceipt()
+	again.ID = "r1"
+	_, err = service.ProcessReceipt(ctx, again)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, errors.ErrInvalidStatusTransition)
+	assert.NotErrorIs(t, err, errors.ErrReceiptValidation)
+
+	stored, err := service.GetReceipt(ctx, "r1")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCompleted, stored.Status)
+	assert.Equal(t, 28, stored.Points)
+}
+
+func TestProcessReceipt_DifferentReceiptsNotFlagged(t *testing.T) {
+	ctx := context.Background()
+	service := NewReceiptService(NewInMemoryStore(), NewDefaultPointsCalculator())
+
+	for i, r := range []*models.Receipt{targetReceipt(), mmReceipt()} {
+		r.ID = string(rune('a' + i))
+		_, err := service.ProcessReceipt(ctx, r)
+		require.NoError(t, err)
+		assert.Equal(t, models.StatusCompleted, r.Status)
+	}
+}
+
+func TestFailPendingReceipt(t *testing.T) {
+	ctx := context.Background()
+	service := NewReceiptService(NewInMemoryStore(), NewDefaultPointsCalculator())
+
+	r := targetReceipt()
+	r.ID = "r1"
+	require.NoError(t, service.StorePendingReceipt(ctx, r))
+	require.NoError(t, service.FailPendingReceipt(ctx, r, "could not be queued"))
+
+	stored, err := service.GetReceipt(ctx, "r1")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusFailed, stored.Status)
+	assert.Equal(t, "could not be queued", stored.ErrorMessage)
+
+	// Only receipts still waiting for the queue can be failed this way
+	assert.ErrorIs(t, service.FailPendingReceipt(ctx, r, "again"), errors.ErrInvalidStatusTransition)
+
+	// Reprocessing gets it queued again
+	_, err = service.ReprocessReceipt(ctx, "r1")
+	require.NoError(t, err)
+	again := targetReceipt()
+	again.ID = "r1"
+	_, err = service.ProcessReceipt(ctx, again)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCompleted, again.Status)
+}
+
+func TestProcessReceipt_CreditsUser(t *testing.T) {
+	ctx := context.Background()
+	service := NewReceiptService(NewInMemoryStore(), NewDefaultPointsCalculator())
+
+	r := targetReceipt()
+	r.ID = "r1"
+	r.UserID = "alice"
+	require.NoError(t, service.StorePendingReceipt(ctx, r))
+	_, err := service.ProcessReceipt(ctx, r)
+	require.NoError(t, err)
+
+	// A flagged duplicate earns its submitter nothing
+	dup := targetReceipt()
+	dup.ID = "dup"
+	dup.UserID = "bob"
+	require.NoError(t, service.StorePendingReceipt(ctx, dup))
+	_, err = service.ProcessReceipt(ctx, dup)
+	require.NoError(t, err)
+
+	points, err := service.GetUserPoints(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 28, points)
+	points, err = service.GetUserPoints(ctx, "bob")
+	require.NoError(t, err)
+	assert.Equal(t, 0, points)
+
+	page, err := service.ListUserReceipts(ctx, "bob", ReceiptQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Receipts, 1)
+	assert.Equal(t, "dup", page.Receipts[0].ID)
+}
+
+func TestFlagReceipt_ReversesCredit(t *testing.T) {
+	ctx := context.Background()
+	service := NewReceiptService(NewInMemoryStore(), NewDefaultPointsCalculator())
+
+	r := targetReceipt()
+	r.ID = "r1"
+	r.UserID = "alice"
+	require.NoError(t, service.StorePendingReceipt(ctx, r))
+	_, err := service.ProcessReceipt(ctx, r)
+	require.NoError(t, err)
+
+	flagged, err := service.FlagReceipt(ctx, "r1", "refunded at the store")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusFlagged, flagged.Status)
+	assert.Equal(t, "refunded at the store", flagged.FlagReason)
+	assert.Equal(t, 0, flagged.Points)
+
+	points, err := service.GetUserPoints(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 0, points)
+	entries, err := service.GetUserLedger(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, models.LedgerCredit, entries[0].Kind)
+	assert.Equal(t, models.LedgerReversal, entries[1].Kind)
+	assert.Equal(t, -28, entries[1].Points)
+
+	// Only completed receipts can be flagged
+	_, err = service.FlagReceipt(ctx, "r1", "again")
+	assert.ErrorIs(t, err, errors.ErrInvalidStatusTransition)
+	_, err = service.FlagReceipt(ctx, "missing", "typo")
+	assert.ErrorIs(t, err, errors.ErrReceiptNotExist)
+
+	// Reprocessing scores it afresh and credits it again
+	_, err = service.ReprocessReceipt(ctx, "r1")
+	require.NoError(t, err)
+	again := targetReceipt()
+	again.ID = "r1"
+	again.UserID = "alice"
+	_, err = service.ProcessReceipt(ctx, again)
+	require.NoError(t, err)
+	points, err = service.GetUserPoints(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 28, points)
+}
+
+func TestRedeemPoints(t *testing.T) {
+	ctx := context.Background()
+	service := NewReceiptService(NewInMemoryStore(), NewDefaultPointsCalculator())
+
+	r := targetReceipt()
+	r.ID = "r1"
+	r.UserID = "alice"
+	require.NoError(t, service.StorePendingReceipt(ctx, r))
+	_, err := service.ProcessReceipt(ctx, r)
+	require.NoError(t, err)
+
+	_, err = service.RedeemPoints(ctx, "alice", "d1", 0)
+	assert.ErrorIs(t, err, errors.ErrInvalidRedemption)
+	_, err = service.RedeemPoints(ctx, "alice", "d1", 29)
+	assert.ErrorIs(t, err, errors.ErrInsufficientPoints)
+
+	entry, err := service.RedeemPoints(ctx, "alice", "d1", 28)
+	require.NoError(t, err)
+	assert.Equal(t, -28, entry.Points)
+	points, err := service.GetUserPoints(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 0, points)
+}
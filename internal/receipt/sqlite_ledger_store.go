@@ -0,0 +1,112 @@
+package receipt
+
+import (
+	"context"
+	"database/sql"
+	stderrors "errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kartikeya55555/fetch-assignment/internal/errors"
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+)
+
+type sqliteLedgerStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteLedgerStore opens the ledger tables in the SQLite database at path.
+func NewSQLiteLedgerStore(path string) (LedgerStore, error) {
+	db, err := openSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteLedgerStore{db: db}, nil
+}
+
+// Both writes below are a single INSERT ... SELECT: SQLite takes the write
+// lock before the SELECT runs, so the balance it reads cannot change before
+// the insert, even across processes.
+
+func (s *sqliteLedgerStore) SettleReceipt(ctx context.Context, userID, receiptID string, points int) (*models.LedgerEntry, error) {
+	e := models.LedgerEntry{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		ReceiptID: receiptID,
+		CreatedAt: time.Now().UTC(),
+	}
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO ledger_entries (id, user_id, receipt_id, kind, points, created_at)
+		 SELECT ?, ?, ?, CASE WHEN ? > net THEN ? ELSE ? END, ? - net, ?
+		 FROM (SELECT COALESCE(SUM(points), 0) AS net FROM ledger_entries WHERE receipt_id = ?)
+		 WHERE net <> ?
+		 RETURNING kind, points`,
+		e.ID, e.UserID, e.ReceiptID, points, models.LedgerCredit, models.LedgerReversal, points, e.CreatedAt,
+		receiptID, points,
+	).Scan(&e.Kind, &e.Points)
+	if stderrors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (s *sqliteLedgerStore) Redeem(ctx context.Context, userID, entryID string, points int) (models.LedgerEntry, error) {
+	e := models.LedgerEntry{
+		ID:        entryID,
+		UserID:    userID,
+		Kind:      models.LedgerDebit,
+		Points:    -points,
+		CreatedAt: time.Now().UTC(),
+	}
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO ledger_entries (id, user_id, receipt_id, kind, points, created_at)
+		 SELECT ?, ?, NULL, ?, ?, ?
+		 WHERE (SELECT COALESCE(SUM(points), 0) FROM ledger_entries WHERE user_id = ?) >= ?`,
+		e.ID, e.UserID, e.Kind, e.Points, e.CreatedAt, userID, points,
+	)
+	if err != nil {
+		return models.LedgerEntry{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return models.LedgerEntry{}, err
+	} else if n == 0 {
+		return models.LedgerEntry{}, errors.ErrInsufficientPoints
+	}
+	return e, nil
+}
+
+func (s *sqliteLedgerStore) Balance(ctx context.Context, userID string) (int, error) {
+	var balance int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(points), 0) FROM ledger_entries WHERE user_id = ?`, userID,
+	).Scan(&balance)
+	return balance, err
+}
+
+func (s *sqliteLedgerStore) Entries(ctx context.Context, userID string) ([]models.LedgerEntry, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, user_id, COALESCE(receipt_id, ''), kind, points, created_at FROM ledger_entries
+		 WHERE user_id = ? ORDER BY created_at, id`, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.LedgerEntry
+	for rows.Next() {
+		var e models.LedgerEntry
+		if err := rows.Scan(&e.ID, &e.UserID, &e.ReceiptID, &e.Kind, &e.Points, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (s *sqliteLedgerStore) Close() error {
+	return s.db.Close()
+}
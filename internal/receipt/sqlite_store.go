@@ -0,0 +1,346 @@
+package receipt
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kartikeya55555/fetch-assignment/internal/errors"
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// migrations are applied in order; a migration's version is its index + 1.
+// Never edit an existing entry, append a new one instead.
+var migrations = []string{
+	// 1) receipts table holding the JSON-encoded receipt
+	`CREATE TABLE IF NOT EXISTS receipts (
+		id         TEXT PRIMARY KEY,
+		status     TEXT NOT NULL,
+		data       TEXT NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	)`,
+	// 2) Idempotency-Key -> receipt mapping for deduplicating submissions
+	`CREATE TABLE IF NOT EXISTS idempotency_keys (
+		key          TEXT PRIMARY KEY,
+		receipt_id   TEXT NOT NULL,
+		request_hash TEXT NOT NULL,
+		created_at   TIMESTAMP NOT NULL
+	)`,
+	// 3) First receipt seen for each fingerprint, for duplicate detection
+	`CREATE TABLE IF NOT EXISTS receipt_fingerprints (
+		fingerprint TEXT PRIMARY KEY,
+		receipt_id  TEXT NOT NULL,
+		created_at  TIMESTAMP NOT NULL
+	)`,
+	// 4) Index for listing receipts by status
+	`CREATE INDEX IF NOT EXISTS receipts_status ON receipts (status)`,
+	// 5) Points ledger; one entry of each kind per receipt
+	`CREATE TABLE IF NOT EXISTS ledger_entries (
+		id         TEXT PRIMARY KEY,
+		user_id    TEXT NOT NULL,
+		receipt_id TEXT NOT NULL,
+		kind       TEXT NOT NULL,
+		points     INTEGER NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		UNIQUE (receipt_id, kind)
+	)`,
+	// 6) Index for reading a user's ledger
+	`CREATE INDEX IF NOT EXISTS ledger_entries_user ON ledger_entries (user_id)`,
+	// 7)-12) Rebuild the ledger without the per-receipt uniqueness so receipts
+	// can be credited, reversed and credited again, and debits need no receipt
+	// 7) A new table without the constraint
+	`CREATE TABLE ledger_entries_v2 (
+		id         TEXT PRIMARY KEY,
+		user_id    TEXT NOT NULL,
+		receipt_id TEXT,
+		kind       TEXT NOT NULL,
+		points     INTEGER NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	)`,
+	// 8) Copy the existing entries
+	`INSERT INTO ledger_entries_v2 (id, user_id, receipt_id, kind, points, created_at)
+		SELECT id, user_id, receipt_id, kind, points, created_at FROM ledger_entries`,
+	// 9) Drop the old table, and its indexes with it
+	`DROP TABLE ledger_entries`,
+	// 10) Take over its name
+	`ALTER TABLE ledger_entries_v2 RENAME TO ledger_entries`,
+	// 11) Recreate the user index dropped in 9)
+	`CREATE INDEX IF NOT EXISTS ledger_entries_user ON ledger_entries (user_id)`,
+	// 12) Index for finding a receipt's entries
+	`CREATE INDEX IF NOT EXISTS ledger_entries_receipt ON ledger_entries (receipt_id)`,
+}
+
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens (or creates) the SQLite database at path and brings
+// its schema up to date.
+func NewSQLiteStore(path string) (ReceiptStore, error) {
+	db, err := openSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("SQLite store ready", "path", path)
+	return &sqliteStore{db: db}, nil
+}
+
+// openSQLite opens the database file shared by the SQLite-backed stores and
+// applies any pending migrations.
+func openSQLite(path string) (*sql.DB, error) {
+	// WAL lets readers in other processes see writes without blocking them.
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=5000", path)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite store: %w", err)
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// migrate applies every migration newer than the recorded schema version.
+// The api and worker share the database file and may start together, so the
+// version is read and the migrations applied in one BEGIN IMMEDIATE
+// transaction: the first process to take the write lock migrates, and the
+// other waits for it and then finds nothing left to do.
+func migrate(db *sql.DB) (err error) {
+	ctx := context.Background()
+	// BEGIN and COMMIT must run on the same connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE`); err != nil {
+		return fmt.Errorf("lock schema: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			conn.ExecContext(ctx, `ROLLBACK`)
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	var current int
+	if err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		if _, err := conn.ExecContext(ctx, migrations[i]); err != nil {
+			return fmt.Errorf("apply migration %d: %w", version, err)
+		}
+		if _, err := conn.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES (?)`, version); err != nil {
+			return fmt.Errorf("record migration %d: %w", version, err)
+		}
+	}
+	if _, err := conn.ExecContext(ctx, `COMMIT`); err != nil {
+		return fmt.Errorf("commit migrations: %w", err)
+	}
+	if current < len(migrations) {
+		slog.Info("Applied store migrations", "from", current, "to", len(migrations))
+	}
+	return nil
+}
+
+func (s *sqliteStore) AddReceipt(ctx context.Context, r *models.Receipt) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO receipts (id, status, data, updated_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(id) DO UPDATE SET status = excluded.status, data = excluded.data, updated_at = excluded.updated_at`,
+		r.ID, r.Status, string(data), time.Now().UTC(),
+	)
+	return err
+}
+
+func (s *sqliteStore) CreateReceipt(ctx context.Context, r *models.Receipt) (bool, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return false, err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO receipts (id, status, data, updated_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(id) DO NOTHING`,
+		r.ID, r.Status, string(data), time.Now().UTC(),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (s *sqliteStore) GetReceipt(ctx context.Context, id string) (*models.Receipt, bool) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM receipts WHERE id = ?`, id).Scan(&data)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.ErrorContext(ctx, "Store GetReceipt failed", "receipt_id", id, "error", err)
+		}
+		return nil, false
+	}
+
+	var rec models.Receipt
+	if err := json.Unmarshal([]byte(data), &rec); err != nil {
+		slog.ErrorContext(ctx, "Corrupt receipt data", "receipt_id", id, "error", err)
+		return nil, false
+	}
+	return &rec, true
+}
+
+func (s *sqliteStore) UpdateReceipt(ctx context.Context, r *models.Receipt, from models.ReceiptStatus) error {
+	if !from.CanTransitionTo(r.Status) {
+		return errors.ErrInvalidStatusTransition
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	// Compare-and-set on status so concurrent workers can't both win
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE receipts SET status = ?, data = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		r.Status, string(data), time.Now().UTC(), r.ID, from,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, found := s.GetReceipt(ctx, r.ID); !found {
+			return errors.ErrReceiptNotExist
+		}
+		return errors.ErrInvalidStatusTransition
+	}
+	return nil
+}
+
+// ListReceipts narrows by status in SQL (the only indexed filter) and
+// applies the rest of q in Go.
+func (s *sqliteStore) ListReceipts(ctx context.Context, q ReceiptQuery) (ReceiptPage, error) {
+	query, args := `SELECT data FROM receipts`, []interface{}{}
+	if q.Status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, q.Status)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return ReceiptPage{}, err
+	}
+	defer rows.Close()
+
+	var receipts []*models.Receipt
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return ReceiptPage{}, err
+		}
+		var rec models.Receipt
+		if err := json.Unmarshal([]byte(data), &rec); err != nil {
+			return ReceiptPage{}, fmt.Errorf("corrupt receipt data: %w", err)
+		}
+		receipts = append(receipts, &rec)
+	}
+	if err := rows.Err(); err != nil {
+		return ReceiptPage{}, err
+	}
+	return applyQuery(receipts, q)
+}
+
+func (s *sqliteStore) CountReceipts(ctx context.Context) (map[models.ReceiptStatus]int, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT status, COUNT(*) FROM receipts GROUP BY status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[models.ReceiptStatus]int)
+	for rows.Next() {
+		var status models.ReceiptStatus
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+func (s *sqliteStore) ClaimIdempotencyKey(ctx context.Context, rec IdempotencyRecord, window time.Duration) (IdempotencyRecord, bool, error) {
+	// A single upsert is atomic: it only overwrites keys older than the window,
+	// so of two concurrent claims exactly one ends up owning the key.
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO idempotency_keys (key, receipt_id, request_hash, created_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(key) DO UPDATE SET
+			receipt_id = excluded.receipt_id,
+			request_hash = excluded.request_hash,
+			created_at = excluded.created_at
+		 WHERE idempotency_keys.created_at < ?`,
+		rec.Key, rec.ReceiptID, rec.RequestHash, rec.CreatedAt.UTC(), rec.CreatedAt.Add(-window).UTC(),
+	)
+	if err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+
+	var stored IdempotencyRecord
+	err = s.db.QueryRowContext(ctx,
+		`SELECT key, receipt_id, request_hash, created_at FROM idempotency_keys WHERE key = ?`, rec.Key,
+	).Scan(&stored.Key, &stored.ReceiptID, &stored.RequestHash, &stored.CreatedAt)
+	if err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+	return stored, stored.ReceiptID == rec.ReceiptID, nil
+}
+
+func (s *sqliteStore) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE key = ?`, key)
+	return err
+}
+
+func (s *sqliteStore) ClaimFingerprint(ctx context.Context, fingerprint, receiptID string) (string, error) {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO receipt_fingerprints (fingerprint, receipt_id, created_at) VALUES (?, ?, ?)
+		 ON CONFLICT(fingerprint) DO NOTHING`,
+		fingerprint, receiptID, time.Now().UTC(),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	var first string
+	err = s.db.QueryRowContext(ctx,
+		`SELECT receipt_id FROM receipt_fingerprints WHERE fingerprint = ?`, fingerprint,
+	).Scan(&first)
+	return first, err
+}
+
+// Ping runs a trivial query, which also fails if the database file has
+// become unreadable.
+func (s *sqliteStore) Ping(ctx context.Context) error {
+	var one int
+	return s.db.QueryRowContext(ctx, `SELECT 1 FROM schema_migrations LIMIT 1`).Scan(&one)
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
@@ -1,38 +1,187 @@
 package receipt
 
 import (
+	"context"
+	"fmt"
 	"sync"
+	"time"
 
+	"github.com/kartikeya55555/fetch-assignment/internal/errors"
 	"github.com/kartikeya55555/fetch-assignment/internal/models"
 )
 
 // ReceiptStore is the interface for storing/fetching receipts.
 type ReceiptStore interface {
-	AddReceipt(r *models.Receipt) error
-	GetReceipt(id string) (*models.Receipt, bool)
+	AddReceipt(ctx context.Context, r *models.Receipt) error
+	// CreateReceipt stores r unless a receipt with its ID already exists, and
+	// reports whether it did. Unlike AddReceipt it never overwrites.
+	CreateReceipt(ctx context.Context, r *models.Receipt) (bool, error)
+	GetReceipt(ctx context.Context, id string) (*models.Receipt, bool)
+	// UpdateReceipt overwrites r only if the stored receipt is still in status
+	// from and from may transition to r.Status; otherwise it returns
+	// errors.ErrInvalidStatusTransition (or errors.ErrReceiptNotExist).
+	UpdateReceipt(ctx context.Context, r *models.Receipt, from models.ReceiptStatus) error
+	// ListReceipts returns one page of receipts matching q. Invalid queries
+	// fail with errors.ErrInvalidQuery.
+	ListReceipts(ctx context.Context, q ReceiptQuery) (ReceiptPage, error)
+	// CountReceipts returns how many receipts are stored in each status.
+	CountReceipts(ctx context.Context) (map[models.ReceiptStatus]int, error)
+
+	// ClaimIdempotencyKey atomically stores rec unless rec.Key was claimed
+	// within window, in which case it returns the earlier record and false.
+	ClaimIdempotencyKey(ctx context.Context, rec IdempotencyRecord, window time.Duration) (IdempotencyRecord, bool, error)
+	// ReleaseIdempotencyKey forgets key so a failed submission can be retried.
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+
+	// ClaimFingerprint records receiptID as the first receipt seen with
+	// fingerprint, unless another receipt got there first; either way it
+	// returns the ID of the first receipt.
+	ClaimFingerprint(ctx context.Context, fingerprint, receiptID string) (string, error)
+
+	// Ping reports whether the store can serve requests.
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// IdempotencyRecord ties a client's Idempotency-Key to the receipt it created,
+// or for a redemption to its ledger entry.
+type IdempotencyRecord struct {
+	Key         string
+	ReceiptID   string // receipt ID, or ledger entry ID for redemptions
+	RequestHash string // hash of the submitted request, to detect key reuse
+	CreatedAt   time.Time
+}
+
+// NewStore builds the store selected by storeType ("memory" or "sqlite").
+// path is only used by disk-backed stores.
+func NewStore(storeType, path string) (ReceiptStore, error) {
+	switch storeType {
+	case "", "memory":
+		return NewInMemoryStore(), nil
+	case "sqlite":
+		return NewSQLiteStore(path)
+	default:
+		return nil, fmt.Errorf("unknown store type %q", storeType)
+	}
 }
 
 type inMemoryStore struct {
-	mu       sync.RWMutex
-	receipts map[string]*models.Receipt
+	mu              sync.RWMutex
+	receipts        map[string]*models.Receipt
+	idempotencyKeys map[string]IdempotencyRecord
+	fingerprints    map[string]string // fingerprint -> first receipt ID
 }
 
 func NewInMemoryStore() ReceiptStore {
 	return &inMemoryStore{
-		receipts: make(map[string]*models.Receipt),
+		receipts:        make(map[string]*models.Receipt),
+		idempotencyKeys: make(map[string]IdempotencyRecord),
+		fingerprints:    make(map[string]string),
 	}
 }
 
-func (s *inMemoryStore) AddReceipt(r *models.Receipt) error {
+// Receipts are copied in and out so callers mutating their *Receipt can't
+// change stored state behind UpdateReceipt's status check.
+func (s *inMemoryStore) AddReceipt(ctx context.Context, r *models.Receipt) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.receipts[r.ID] = r
+	cp := *r
+	s.receipts[r.ID] = &cp
 	return nil
 }
 
-func (s *inMemoryStore) GetReceipt(id string) (*models.Receipt, bool) {
+func (s *inMemoryStore) CreateReceipt(ctx context.Context, r *models.Receipt) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, found := s.receipts[r.ID]; found {
+		return false, nil
+	}
+	cp := *r
+	s.receipts[r.ID] = &cp
+	return true, nil
+}
+
+func (s *inMemoryStore) GetReceipt(ctx context.Context, id string) (*models.Receipt, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	rec, found := s.receipts[id]
-	return rec, found
+	if !found {
+		return nil, false
+	}
+	cp := *rec
+	return &cp, true
+}
+
+func (s *inMemoryStore) UpdateReceipt(ctx context.Context, r *models.Receipt, from models.ReceiptStatus) error {
+	if !from.CanTransitionTo(r.Status) {
+		return errors.ErrInvalidStatusTransition
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, found := s.receipts[r.ID]
+	if !found {
+		return errors.ErrReceiptNotExist
+	}
+	if current.Status != from {
+		return errors.ErrInvalidStatusTransition
+	}
+	cp := *r
+	s.receipts[r.ID] = &cp
+	return nil
+}
+
+func (s *inMemoryStore) ListReceipts(ctx context.Context, q ReceiptQuery) (ReceiptPage, error) {
+	s.mu.RLock()
+	receipts := make([]*models.Receipt, 0, len(s.receipts))
+	for _, rec := range s.receipts {
+		cp := *rec
+		receipts = append(receipts, &cp)
+	}
+	s.mu.RUnlock()
+	return applyQuery(receipts, q)
+}
+
+func (s *inMemoryStore) CountReceipts(ctx context.Context) (map[models.ReceiptStatus]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	counts := make(map[models.ReceiptStatus]int)
+	for _, rec := range s.receipts {
+		counts[rec.Status]++
+	}
+	return counts, nil
+}
+
+func (s *inMemoryStore) ClaimIdempotencyKey(ctx context.Context, rec IdempotencyRecord, window time.Duration) (IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, found := s.idempotencyKeys[rec.Key]; found && rec.CreatedAt.Sub(existing.CreatedAt) < window {
+		return existing, false, nil
+	}
+	s.idempotencyKeys[rec.Key] = rec
+	return rec, true, nil
+}
+
+func (s *inMemoryStore) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.idempotencyKeys, key)
+	return nil
+}
+
+func (s *inMemoryStore) ClaimFingerprint(ctx context.Context, fingerprint, receiptID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if first, found := s.fingerprints[fingerprint]; found {
+		return first, nil
+	}
+	s.fingerprints[fingerprint] = receiptID
+	return receiptID, nil
+}
+
+func (s *inMemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *inMemoryStore) Close() error {
+	return nil
 }
@@ -0,0 +1,164 @@
+package receipt
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kartikeya55555/fetch-assignment/internal/errors"
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// forEachStore runs fn against every ReceiptStore implementation.
+func forEachStore(t *testing.T, fn func(t *testing.T, store ReceiptStore)) {
+	t.Run("memory", func(t *testing.T) {
+		fn(t, NewInMemoryStore())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "receipts.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { store.Close() })
+		fn(t, store)
+	})
+}
+
+func TestStore_AddAndGetReceipt(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store ReceiptStore) {
+		ctx := context.Background()
+		require.NoError(t, store.AddReceipt(ctx, &models.Receipt{ID: "r1", Status: models.StatusPending}))
+		require.NoError(t, store.AddReceipt(ctx, &models.Receipt{ID: "r1", Status: models.StatusCompleted, Points: 28}))
+
+		rec, found := store.GetReceipt(ctx, "r1")
+		require.True(t, found)
+		assert.Equal(t, models.StatusCompleted, rec.Status)
+		assert.Equal(t, 28, rec.Points)
+
+		_, found = store.GetReceipt(ctx, "missing")
+		assert.False(t, found)
+	})
+}
+
+func TestStore_UpdateReceipt(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store ReceiptStore) {
+		ctx := context.Background()
+		require.NoError(t, store.AddReceipt(ctx, &models.Receipt{ID: "r1", Status: models.StatusPending}))
+
+		r := &models.Receipt{ID: "r1", Status: models.StatusProcessing}
+		require.NoError(t, store.UpdateReceipt(ctx, r, models.StatusPending))
+
+		// Stored status no longer matches the expected one
+		r.Status = models.StatusProcessing
+		assert.ErrorIs(t, store.UpdateReceipt(ctx, r, models.StatusPending), errors.ErrInvalidStatusTransition)
+
+		// Transition not allowed by the state machine
+		r.Status = models.StatusPending
+		assert.ErrorIs(t, store.UpdateReceipt(ctx, r, models.StatusProcessing), errors.ErrInvalidStatusTransition)
+
+		r = &models.Receipt{ID: "missing", Status: models.StatusProcessing}
+		assert.ErrorIs(t, store.UpdateReceipt(ctx, r, models.StatusPending), errors.ErrReceiptNotExist)
+	})
+}
+
+func TestStore_ClaimIdempotencyKey(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store ReceiptStore) {
+		ctx := context.Background()
+		now := time.Now()
+		first := IdempotencyRecord{Key: "k", ReceiptID: "r1", RequestHash: "h", CreatedAt: now.Add(-time.Minute)}
+
+		stored, claimed, err := store.ClaimIdempotencyKey(ctx, first, time.Hour)
+		require.NoError(t, err)
+		assert.True(t, claimed)
+		assert.Equal(t, "r1", stored.ReceiptID)
+
+		// Repeat within the window gets the original receipt
+		repeat := IdempotencyRecord{Key: "k", ReceiptID: "r2", RequestHash: "h", CreatedAt: now}
+		stored, claimed, err = store.ClaimIdempotencyKey(ctx, repeat, time.Hour)
+		require.NoError(t, err)
+		assert.False(t, claimed)
+		assert.Equal(t, "r1", stored.ReceiptID)
+
+		// Once the window has passed the key can be reused
+		stored, claimed, err = store.ClaimIdempotencyKey(ctx, repeat, time.Second)
+		require.NoError(t, err)
+		assert.True(t, claimed)
+		assert.Equal(t, "r2", stored.ReceiptID)
+
+		// Released keys are free again
+		require.NoError(t, store.ReleaseIdempotencyKey(ctx, "k"))
+		third := IdempotencyRecord{Key: "k", ReceiptID: "r3", RequestHash: "h", CreatedAt: now}
+		_, claimed, err = store.ClaimIdempotencyKey(ctx, third, time.Hour)
+		require.NoError(t, err)
+		assert.True(t, claimed)
+	})
+}
+
+func TestStore_CountReceipts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store ReceiptStore) {
+		ctx := context.Background()
+		require.NoError(t, store.AddReceipt(ctx, &models.Receipt{ID: "r1", Status: models.StatusPending}))
+		require.NoError(t, store.AddReceipt(ctx, &models.Receipt{ID: "r2", Status: models.StatusPending}))
+		require.NoError(t, store.AddReceipt(ctx, &models.Receipt{ID: "r3", Status: models.StatusCompleted}))
+
+		counts, err := store.CountReceipts(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, map[models.ReceiptStatus]int{
+			models.StatusPending:   2,
+			models.StatusCompleted: 1,
+		}, counts)
+	})
+}
+
+func TestStore_Ping(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store ReceiptStore) {
+		assert.NoError(t, store.Ping(context.Background()))
+	})
+}
+
+func TestSQLite_ConcurrentMigrations(t *testing.T) {
+	// The api and worker open the same file at startup
+	path := filepath.Join(t.TempDir(), "receipts.db")
+	start := make(chan struct{})
+	errs := make(chan error, 8)
+	for range cap(errs) {
+		go func() {
+			<-start
+			db, err := openSQLite(path)
+			if err == nil {
+				db.Close()
+			}
+			errs <- err
+		}()
+	}
+	close(start)
+	for range cap(errs) {
+		require.NoError(t, <-errs)
+	}
+
+	db, err := openSQLite(path)
+	require.NoError(t, err)
+	defer db.Close()
+	var applied int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&applied))
+	assert.Equal(t, len(migrations), applied)
+}
+
+func TestStore_CreateReceipt(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store ReceiptStore) {
+		ctx := context.Background()
+		created, err := store.CreateReceipt(ctx, &models.Receipt{ID: "r1", Status: models.StatusCompleted, Points: 28})
+		require.NoError(t, err)
+		assert.True(t, created)
+
+		created, err = store.CreateReceipt(ctx, &models.Receipt{ID: "r1", Status: models.StatusPending})
+		require.NoError(t, err)
+		assert.False(t, created)
+
+		rec, found := store.GetReceipt(ctx, "r1")
+		require.True(t, found)
+		assert.Equal(t, models.StatusCompleted, rec.Status)
+		assert.Equal(t, 28, rec.Points)
+	})
+}
@@ -0,0 +1,99 @@
+package receipt
+
+import (
+	"context"
+	"time"
+
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	"github.com/kartikeya55555/fetch-assignment/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startWrite starts a client span for a store write named op.
+func startWrite(ctx context.Context, op string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "store."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+type tracedStore struct {
+	ReceiptStore
+}
+
+// NewTracedStore wraps store so each write gets its own span; reads are
+// passed through untraced.
+func NewTracedStore(store ReceiptStore) ReceiptStore {
+	return &tracedStore{ReceiptStore: store}
+}
+
+func (s *tracedStore) AddReceipt(ctx context.Context, r *models.Receipt) (err error) {
+	ctx, span := startWrite(ctx, "AddReceipt", attribute.String("receipt.id", r.ID))
+	defer func() { tracing.End(span, err) }()
+	return s.ReceiptStore.AddReceipt(ctx, r)
+}
+
+func (s *tracedStore) CreateReceipt(ctx context.Context, r *models.Receipt) (created bool, err error) {
+	ctx, span := startWrite(ctx, "CreateReceipt", attribute.String("receipt.id", r.ID))
+	defer func() {
+		span.SetAttributes(attribute.Bool("created", created))
+		tracing.End(span, err)
+	}()
+	return s.ReceiptStore.CreateReceipt(ctx, r)
+}
+
+func (s *tracedStore) UpdateReceipt(ctx context.Context, r *models.Receipt, from models.ReceiptStatus) (err error) {
+	ctx, span := startWrite(ctx, "UpdateReceipt",
+		attribute.String("receipt.id", r.ID),
+		attribute.String("receipt.status.from", string(from)),
+		attribute.String("receipt.status.to", string(r.Status)),
+	)
+	defer func() { tracing.End(span, err) }()
+	return s.ReceiptStore.UpdateReceipt(ctx, r, from)
+}
+
+func (s *tracedStore) ClaimIdempotencyKey(ctx context.Context, rec IdempotencyRecord, window time.Duration) (_ IdempotencyRecord, claimed bool, err error) {
+	ctx, span := startWrite(ctx, "ClaimIdempotencyKey", attribute.String("receipt.id", rec.ReceiptID))
+	defer func() {
+		span.SetAttributes(attribute.Bool("claimed", claimed))
+		tracing.End(span, err)
+	}()
+	return s.ReceiptStore.ClaimIdempotencyKey(ctx, rec, window)
+}
+
+func (s *tracedStore) ReleaseIdempotencyKey(ctx context.Context, key string) (err error) {
+	ctx, span := startWrite(ctx, "ReleaseIdempotencyKey")
+	defer func() { tracing.End(span, err) }()
+	return s.ReceiptStore.ReleaseIdempotencyKey(ctx, key)
+}
+
+func (s *tracedStore) ClaimFingerprint(ctx context.Context, fingerprint, receiptID string) (_ string, err error) {
+	ctx, span := startWrite(ctx, "ClaimFingerprint", attribute.String("receipt.id", receiptID))
+	defer func() { tracing.End(span, err) }()
+	return s.ReceiptStore.ClaimFingerprint(ctx, fingerprint, receiptID)
+}
+
+type tracedLedgerStore struct {
+	LedgerStore
+}
+
+// NewTracedLedgerStore wraps ledger so each write gets its own span.
+func NewTracedLedgerStore(ledger LedgerStore) LedgerStore {
+	return &tracedLedgerStore{LedgerStore: ledger}
+}
+
+func (s *tracedLedgerStore) SettleReceipt(ctx context.Context, userID, receiptID string, points int) (_ *models.LedgerEntry, err error) {
+	ctx, span := startWrite(ctx, "SettleReceipt",
+		attribute.String("receipt.id", receiptID),
+		attribute.Int("receipt.points", points),
+	)
+	defer func() { tracing.End(span, err) }()
+	return s.LedgerStore.SettleReceipt(ctx, userID, receiptID, points)
+}
+
+func (s *tracedLedgerStore) Redeem(ctx context.Context, userID, entryID string, points int) (_ models.LedgerEntry, err error) {
+	ctx, span := startWrite(ctx, "Redeem", attribute.Int("points", points))
+	defer func() { tracing.End(span, err) }()
+	return s.LedgerStore.Redeem(ctx, userID, entryID, points)
+}
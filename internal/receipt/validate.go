@@ -1,31 +1,151 @@
 package receipt
 
 import (
+	"fmt"
+	"reflect"
 	"regexp"
-	"time"
+	"strings"
 
+	"github.com/go-playground/validator/v10"
 	"github.com/kartikeya55555/fetch-assignment/internal/errors"
 	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	"github.com/kartikeya55555/fetch-assignment/internal/money"
 )
 
-func validateReceipt(r *models.Receipt) []string {
-	var issues []string
+// Character patterns from the receipt API spec
+var (
+	retailerPattern    = regexp.MustCompile(`^[\w\s\-&]+$`)
+	descriptionPattern = regexp.MustCompile(`^[\w\s\-]+$`)
+)
+
+// structValidator checks the `validate` tags on models.Receipt and models.Item.
+var structValidator = newStructValidator()
+
+func newStructValidator() *validator.Validate {
+	v := validator.New()
+
+	// Report fields by their JSON names so paths match the request body
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	v.RegisterValidation("amount", func(fl validator.FieldLevel) bool {
+		_, err := money.ParseCents(fl.Field().String())
+		return err == nil
+	})
+	v.RegisterValidation("retailer", func(fl validator.FieldLevel) bool {
+		return retailerPattern.MatchString(fl.Field().String())
+	})
+	v.RegisterValidation("description", func(fl validator.FieldLevel) bool {
+		return descriptionPattern.MatchString(fl.Field().String())
+	})
+	return v
+}
 
-	// Validate PurchaseDate
-	if _, err := time.Parse("2006-01-02", r.PurchaseDate); err != nil {
-		issues = append(issues, errors.ErrNotValidDateFormat.Error())
+// ValidateStructure runs the cheap, per-field checks from the `validate`
+// tags: required fields, date/time/amount formats and character patterns.
+// The API runs it before enqueueing so obviously bad receipts are rejected
+// right away.
+func ValidateStructure(r *models.Receipt) []models.FieldError {
+	err := structValidator.Struct(r)
+	if err == nil {
+		return nil
 	}
+	validationErrs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return []models.FieldError{{Field: "", Code: "invalid", Message: err.Error()}}
+	}
+	issues := make([]models.FieldError, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		issues = append(issues, toFieldError(fe))
+	}
+	return issues
+}
+
+// validateReceipt is the worker's full check: ValidateStructure plus
+// cross-field consistency. It also fills in r.TotalCents and each item's
+// PriceCents, which the points rules rely on.
+func validateReceipt(r *models.Receipt) []models.FieldError {
+	issues := ValidateStructure(r)
 
-	// Validate PurchaseTime
-	if _, err := time.Parse("15:04", r.PurchaseTime); err != nil {
-		issues = append(issues, errors.ErrNotValidTimeFormat.Error())
+	// Formats are checked above, so parse errors just leave zero cents
+	r.TotalCents, _ = money.ParseCents(r.Total)
+	var itemsCents int64
+	for i := range r.Items {
+		r.Items[i].PriceCents, _ = money.ParseCents(r.Items[i].Price)
+		itemsCents += r.Items[i].PriceCents
 	}
 
-	// Validate total format (\d+\.\d{2})
-	matched, _ := regexp.MatchString(`^\d+\.\d{2}$`, r.Total)
-	if !matched {
-		issues = append(issues, errors.ErrNotValidTotalFormat.Error())
+	// The sum only means something once every amount parsed
+	if len(issues) == 0 && itemsCents != r.TotalCents {
+		issues = append(issues, models.FieldError{
+			Field: "total",
+			Code:  "mismatch",
+			Message: fmt.Sprintf("%s: items sum to %s but total is %s",
+				errors.ErrItemsTotalMismatch.Error(), money.FormatCents(itemsCents), r.Total),
+		})
 	}
 
 	return issues
 }
+
+// toFieldError turns a validator error into a models.FieldError.
+func toFieldError(fe validator.FieldError) models.FieldError {
+	// Namespace is "Receipt.items[0].price"; drop the struct name
+	field := fe.Namespace()
+	if i := strings.Index(field, "."); i >= 0 {
+		field = field[i+1:]
+	}
+
+	code, message := fe.Tag(), ""
+	switch fe.Tag() {
+	case "required":
+		message = field + " is required"
+	case "min":
+		message = field + " must contain at least one item"
+	case "datetime":
+		code = "format"
+		message = errors.ErrNotValidDateFormat.Error() + ", expected YYYY-MM-DD"
+		if field == "purchaseTime" {
+			message = errors.ErrNotValidTimeFormat.Error() + ", expected HH:MM (24-hour)"
+		}
+	case "amount":
+		code = "format"
+		message = errors.ErrNotValidTotalFormat.Error() + ", expected 0.00"
+		if field != "total" {
+			message = errors.ErrNotValidPriceFormat.Error() + ", expected 0.00"
+		}
+	case "retailer":
+		code = "pattern"
+		message = "retailer may only contain letters, digits, spaces, '-' and '&'"
+	case "description":
+		code = "pattern"
+		message = "shortDescription may only contain letters, digits, spaces and '-'"
+	default:
+		message = fmt.Sprintf("%s failed %q validation", field, fe.Tag())
+	}
+	return models.FieldError{Field: field, Code: code, Message: message}
+}
+
+// joinFieldErrors flattens issues into the single ErrorMessage string.
+func joinFieldErrors(issues []models.FieldError) string {
+	msgs := make([]string, len(issues))
+	for i, issue := range issues {
+		msgs[i] = issue.Field + ": " + issue.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// FailedFields lists the fields named in issues without their messages,
+// which can quote receipt contents, so they are safe to log.
+func FailedFields(issues []models.FieldError) []string {
+	fields := make([]string, len(issues))
+	for i, issue := range issues {
+		fields[i] = issue.Field
+	}
+	return fields
+}
@@ -0,0 +1,81 @@
+package receipt
+
+import (
+	"testing"
+
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateReceipt(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(r *models.Receipt)
+		want   []models.FieldError
+	}{
+		{
+			name:   "valid",
+			mutate: func(r *models.Receipt) {},
+		},
+		{
+			name:   "missing purchase date",
+			mutate: func(r *models.Receipt) { r.PurchaseDate = "" },
+			want:   []models.FieldError{{Field: "purchaseDate", Code: "required"}},
+		},
+		{
+			name:   "bad time",
+			mutate: func(r *models.Receipt) { r.PurchaseTime = "2pm" },
+			want:   []models.FieldError{{Field: "purchaseTime", Code: "format"}},
+		},
+		{
+			name:   "retailer with disallowed characters",
+			mutate: func(r *models.Receipt) { r.Retailer = "Target!" },
+			want:   []models.FieldError{{Field: "retailer", Code: "pattern"}},
+		},
+		{
+			name:   "bad item price",
+			mutate: func(r *models.Receipt) { r.Items[2].Price = "1.2" },
+			want:   []models.FieldError{{Field: "items[2].price", Code: "format"}},
+		},
+		{
+			name:   "missing item description",
+			mutate: func(r *models.Receipt) { r.Items[0].ShortDescription = "" },
+			want:   []models.FieldError{{Field: "items[0].shortDescription", Code: "required"}},
+		},
+		{
+			name:   "no items",
+			mutate: func(r *models.Receipt) { r.Items = []models.Item{} },
+			want:   []models.FieldError{{Field: "items", Code: "min"}},
+		},
+		{
+			name:   "items do not sum to total",
+			mutate: func(r *models.Receipt) { r.Total = "35.36" },
+			want:   []models.FieldError{{Field: "total", Code: "mismatch"}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := targetReceipt()
+			tc.mutate(r)
+
+			issues := validateReceipt(r)
+			assert.Len(t, issues, len(tc.want))
+			for i := range tc.want {
+				if i >= len(issues) {
+					break
+				}
+				assert.Equal(t, tc.want[i].Field, issues[i].Field)
+				assert.Equal(t, tc.want[i].Code, issues[i].Code)
+				assert.NotEmpty(t, issues[i].Message)
+			}
+		})
+	}
+}
+
+func TestValidateReceipt_SetsCents(t *testing.T) {
+	r := targetReceipt()
+	assert.Empty(t, validateReceipt(r))
+	assert.Equal(t, int64(3535), r.TotalCents)
+	assert.Equal(t, int64(335), r.Items[3].PriceCents)
+}
@@ -0,0 +1,32 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestEnd(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	_, ok := tracer.Start(context.Background(), "ok")
+	End(ok, nil)
+	_, failed := tracer.Start(context.Background(), "failed")
+	End(failed, errors.New("queue is not initialized"))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Empty(t, spans[0].Events())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "queue is not initialized", spans[1].Status().Description)
+	require.Len(t, spans[1].Events(), 1)
+	assert.Equal(t, "exception", spans[1].Events()[0].Name)
+}
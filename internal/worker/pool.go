@@ -0,0 +1,168 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	awsg "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/kartikeya55555/fetch-assignment/internal/aws"
+	"github.com/kartikeya55555/fetch-assignment/internal/logging"
+)
+
+// Pool runs several SQS consumers that feed a shared Processor.
+type Pool interface {
+	Run(ctx context.Context)
+	// LastActive is the least recent time any consumer polled or finished a
+	// message, or zero if some consumer hasn't started yet. A stuck or dead
+	// consumer makes it fall behind.
+	LastActive() time.Time
+}
+
+type pool struct {
+	sqsClient   aws.SQSClient
+	processor   Processor
+	concurrency int
+	batchSize   int
+	idleBackoff time.Duration
+	logger      *slog.Logger
+	heartbeats  []atomic.Int64 // per consumer, UnixNano of its last activity
+}
+
+// NewPool creates a pool of concurrency consumers, each receiving up to
+// batchSize messages per poll and waiting idleBackoff after an empty poll.
+func NewPool(
+	sqsClient aws.SQSClient,
+	processor Processor,
+	concurrency, batchSize int,
+	idleBackoff time.Duration,
+	logger *slog.Logger,
+) Pool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	// SQS returns at most 10 messages per ReceiveMessage call
+	if batchSize < 1 || batchSize > 10 {
+		batchSize = 10
+	}
+	return &pool{
+		sqsClient:   sqsClient,
+		processor:   processor,
+		concurrency: concurrency,
+		batchSize:   batchSize,
+		idleBackoff: idleBackoff,
+		logger:      logger,
+		heartbeats:  make([]atomic.Int64, concurrency),
+	}
+}
+
+// Run starts the consumers and blocks until ctx is cancelled and every
+// consumer has finished the message it was processing.
+func (p *pool) Run(ctx context.Context) {
+	p.logger.Info("Starting worker pool", "consumers", p.concurrency, "batch_size", p.batchSize)
+
+	var wg sync.WaitGroup
+	for i := 1; i <= p.concurrency; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			p.consume(ctx, id)
+		}(i)
+	}
+	wg.Wait()
+	p.logger.Info("Worker pool stopped")
+}
+
+func (p *pool) LastActive() time.Time {
+	var oldest int64
+	for i := range p.heartbeats {
+		beat := p.heartbeats[i].Load()
+		if beat == 0 {
+			return time.Time{}
+		}
+		if oldest == 0 || beat < oldest {
+			oldest = beat
+		}
+	}
+	return time.Unix(0, oldest)
+}
+
+// beat records that consumer id is making progress.
+func (p *pool) beat(id int) {
+	p.heartbeats[id-1].Store(time.Now().UnixNano())
+}
+
+// consume long-polls SQS and processes each batch; it only backs off when
+// the queue is empty or unreachable, so a busy queue is drained back to back.
+// Once ctx is cancelled it stops polling; messages of the current batch that
+// were not started stay invisible until their timeout and are redelivered.
+func (p *pool) consume(ctx context.Context, id int) {
+	for ctx.Err() == nil {
+		p.beat(id)
+		messages, err := p.sqsClient.GetMessages(ctx, p.batchSize)
+		if ctx.Err() != nil {
+			// Shutdown interrupted the long poll
+			return
+		}
+		if err != nil {
+			p.logger.ErrorContext(ctx, "Failed to receive messages", "consumer", id, "error", err)
+			sleep(ctx, p.idleBackoff)
+			continue
+		}
+		if len(messages) == 0 {
+			sleep(ctx, p.idleBackoff)
+			continue
+		}
+
+		for _, msg := range messages {
+			if ctx.Err() != nil {
+				break
+			}
+			// In-flight work must finish even though ctx is being cancelled
+			p.handle(context.WithoutCancel(ctx), id, msg)
+			p.beat(id)
+		}
+	}
+}
+
+// sleep waits for d or until ctx is cancelled, whichever comes first.
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
+
+// handle processes one message and then deletes it or schedules a retry.
+func (p *pool) handle(ctx context.Context, id int, msg *sqs.Message) {
+	if msg.Body == nil {
+		return
+	}
+	ctx = logging.With(ctx, slog.Int("consumer", id), slog.String("message_id", awsg.StringValue(msg.MessageId)))
+	p.logger.DebugContext(ctx, "Received message", "receive_count", ReceiveCount(msg))
+
+	if err := p.processor.ProcessMessage(ctx, msg); err != nil {
+		if !IsPermanent(err) {
+			// Leave it on the queue; SQS moves it to the DLQ after MaxReceiveCount tries
+			delay := RetryDelay(ReceiveCount(msg))
+			p.logger.WarnContext(ctx, "Failed to process message, retrying", "retry_in", delay.String(), "error", err)
+			if err := p.sqsClient.ChangeVisibility(ctx, msg.ReceiptHandle, delay); err != nil {
+				p.logger.ErrorContext(ctx, "Failed to delay message retry", "error", err)
+			}
+			return
+		}
+		p.logger.WarnContext(ctx, "Message failed permanently, removing from queue", "error", loggableError(err))
+	}
+
+	// Delete message once it is done, successfully or not
+	if err := p.sqsClient.DeleteMessage(ctx, msg.ReceiptHandle); err != nil {
+		p.logger.ErrorContext(ctx, "Failed to delete message", "error", err)
+		return
+	}
+	p.logger.DebugContext(ctx, "Message removed from queue")
+}
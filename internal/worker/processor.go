@@ -1,77 +1,147 @@
 package worker
 
 import (
+	"context"
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"time"
 
+	awsg "github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/kartikeya55555/fetch-assignment/internal/aws"
+	"github.com/kartikeya55555/fetch-assignment/internal/errors"
+	"github.com/kartikeya55555/fetch-assignment/internal/logging"
+	"github.com/kartikeya55555/fetch-assignment/internal/metrics"
 	"github.com/kartikeya55555/fetch-assignment/internal/models"
 	"github.com/kartikeya55555/fetch-assignment/internal/receipt"
+	"github.com/kartikeya55555/fetch-assignment/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Processor interface {
-	ProcessMessage(msg *sqs.Message) error
+	ProcessMessage(ctx context.Context, msg *sqs.Message) error
 }
 
 type processor struct {
 	sqsClient aws.SQSClient
 	snsClient aws.SNSClient
 	service   receipt.ReceiptService
+	queueName string
+	logger    *slog.Logger
 }
 
+// NewProcessor handles messages from the SQS queue queueName, which names
+// the consumer spans as SendMessage names the producer ones.
 func NewProcessor(
 	sqsClient aws.SQSClient,
 	snsClient aws.SNSClient,
 	service receipt.ReceiptService,
+	queueName string,
+	logger *slog.Logger,
 ) Processor {
 	return &processor{
 		sqsClient: sqsClient,
 		snsClient: snsClient,
 		service:   service,
+		queueName: queueName,
+		logger:    logger,
 	}
 }
 
-func (p *processor) ProcessMessage(msg *sqs.Message) error {
-	// Log the raw message body at the start
-	log.Printf("[Worker] Start ProcessMessage - raw message: %s\n", *msg.Body)
+// ProcessMessage continues the trace that QueueReceipt started, using the
+// trace context SendMessage put in the message attributes.
+func (p *processor) ProcessMessage(ctx context.Context, msg *sqs.Message) (err error) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, aws.SQSAttributeCarrier(msg.MessageAttributes))
+	ctx, span := tracing.Tracer().Start(ctx, p.queueName+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemAWSSqs,
+			semconv.MessagingDestinationName(p.queueName),
+			semconv.MessagingMessageID(awsg.StringValue(msg.MessageId)),
+			attribute.Int("messaging.aws_sqs.receive_count", ReceiveCount(msg)),
+		),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	metrics.MessagesReceived.Inc()
+	if sent, ok := SentAt(msg); ok {
+		metrics.MessageLag.Observe(time.Since(sent).Seconds())
+	}
 
 	// Attempt to unmarshal into our Receipt struct
 	var r models.Receipt
-	err := json.Unmarshal([]byte(*msg.Body), &r)
+	err = json.Unmarshal([]byte(*msg.Body), &r)
 	if err != nil {
-		return fmt.Errorf("[Worker] failed to unmarshal receipt: %v", err)
+		metrics.MessagesFailed.WithLabelValues("permanent").Inc()
+		return fmt.Errorf("[Worker] %w: failed to unmarshal receipt: %v", errors.ErrMalformedMessage, err)
 	}
 
-	// Log what we got from unmarshaling
-	log.Printf("[Worker] Unmarshalled Receipt => ID=%s, Status=%s, Retailer=%s, Points=%d\n",
-		r.ID, r.Status, r.Retailer, r.Points)
+	span.SetAttributes(attribute.String("receipt.id", r.ID))
+	ctx = logging.With(ctx, slog.String("receipt_id", r.ID))
 
 	// Call the service to do the heavy-lifting (validation, points, store update)
-	log.Printf("[Worker] Calling service.ProcessReceipt for ID=%s\n", r.ID)
-	receiptID, err := p.service.ProcessReceipt(&r)
+	start := time.Now()
+	_, err = p.service.ProcessReceipt(ctx, &r)
+	metrics.ProcessDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
-		log.Printf("[Worker] Receipt FAILED: %v\n", err)
+		if stderrors.Is(err, errors.ErrInvalidStatusTransition) {
+			// Duplicate or late delivery for a receipt another delivery already handled
+			p.logger.InfoContext(ctx, "Skipping stale message", "error", err)
+			metrics.MessagesProcessed.WithLabelValues("SKIPPED").Inc()
+			return nil
+		}
+		if !IsPermanent(err) {
+			// Transient failure: the message will be redelivered, so don't announce it yet
+			p.logger.WarnContext(ctx, "Receipt hit a retryable error", "error", err)
+			metrics.MessagesFailed.WithLabelValues("retryable").Inc()
+			return err
+		}
+		p.logger.InfoContext(ctx, "Receipt failed", "error", loggableError(err), "fields", receipt.FailedFields(r.ValidationErrors))
+		metrics.MessagesFailed.WithLabelValues("permanent").Inc()
 		// Publish failure to SNS
-		failMsg := fmt.Sprintf("Receipt %s failed: %v", r.ID, err)
-		if snsErr := p.snsClient.Publish(failMsg); snsErr != nil {
-			log.Printf("[Worker] Failed to publish failure message to SNS: %v\n", snsErr)
+		event := models.NewReceiptEvent(models.EventReceiptFailed, &r)
+		event.Errors = failureReasons(&r, err)
+		if snsErr := p.snsClient.Publish(ctx, event); snsErr != nil {
+			p.logger.ErrorContext(ctx, "Failed to publish failure event", "error", snsErr)
 		}
 		return err
 	}
 
 	// If we get here, ProcessReceipt succeeded => should have updated store, set status=COMPLETED
-	log.Printf("[Worker] Receipt processed successfully with ID: %s (Status now=%s)\n", receiptID, r.Status)
+	p.logger.DebugContext(ctx, "Receipt processed", "receipt", r)
+	metrics.MessagesProcessed.WithLabelValues(string(r.Status)).Inc()
+	if r.Status == models.StatusCompleted {
+		metrics.Points.Observe(float64(r.Points))
+	}
 
 	// Publish success to SNS (optional error check)
-	successMsg := fmt.Sprintf("Receipt %s processed successfully.", receiptID)
-	if snsErr := p.snsClient.Publish(successMsg); snsErr != nil {
-		log.Printf("[Worker] Failed to publish success message to SNS: %v\n", snsErr)
-	} else {
-		log.Printf("[Worker] Successfully published success message to SNS for ID=%s\n", receiptID)
+	eventType := models.EventReceiptCompleted
+	if r.Status == models.StatusFlagged {
+		eventType = models.EventReceiptFlagged
+	}
+	event := models.NewReceiptEvent(eventType, &r)
+	if snsErr := p.snsClient.Publish(ctx, event); snsErr != nil {
+		p.logger.ErrorContext(ctx, "Failed to publish success event", "error", snsErr)
 	}
 
 	// Return nil => message was processed successfully
 	return nil
 }
+
+// failureReasons lists the validation issues recorded on r, falling back to
+// err when the receipt never got that far.
+func failureReasons(r *models.Receipt, err error) []string {
+	if len(r.ValidationErrors) == 0 {
+		return []string{err.Error()}
+	}
+	reasons := make([]string, len(r.ValidationErrors))
+	for i, fe := range r.ValidationErrors {
+		reasons[i] = fe.Field + ": " + fe.Message
+	}
+	return reasons
+}
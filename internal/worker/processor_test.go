@@ -0,0 +1,89 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	awsg "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/kartikeya55555/fetch-assignment/internal/aws"
+	"github.com/kartikeya55555/fetch-assignment/internal/logging"
+	"github.com/kartikeya55555/fetch-assignment/internal/models"
+	"github.com/kartikeya55555/fetch-assignment/internal/receipt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type fakeSNS struct {
+	aws.SNSClient
+	events []models.ReceiptEvent
+}
+
+func (f *fakeSNS) Publish(_ context.Context, event models.ReceiptEvent) error {
+	f.events = append(f.events, event)
+	return nil
+}
+
+type fakeSQS struct {
+	aws.SQSClient
+	deleted int
+}
+
+func (f *fakeSQS) DeleteMessage(context.Context, *string) error {
+	f.deleted++
+	return nil
+}
+
+func TestPool_ValidationFailureDoesNotLogAmounts(t *testing.T) {
+	var logs bytes.Buffer
+	logger := logging.New(&logs, slog.LevelDebug)
+	service := receipt.NewReceiptService(receipt.NewInMemoryStore(), receipt.NewDefaultPointsCalculator(), receipt.WithLogger(logger))
+	sqsClient, snsClient := &fakeSQS{}, &fakeSNS{}
+	p := NewPool(sqsClient, NewProcessor(sqsClient, snsClient, service, "receipt-queue", logger), 1, 10, 0, logger).(*pool)
+
+	// The items sum to 6.49, so the worker fails the receipt on its total
+	body := `{"id":"r1","retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01",` +
+		`"items":[{"shortDescription":"Mountain Dew 12PK","price":"6.49"}],"total":"987.65"}`
+	p.handle(context.Background(), 0, &sqs.Message{
+		MessageId:     awsg.String("m1"),
+		ReceiptHandle: awsg.String("h1"),
+		Body:          awsg.String(body),
+	})
+
+	assert.Equal(t, 1, sqsClient.deleted)
+	require.Len(t, snsClient.events, 1)
+	assert.Equal(t, models.EventReceiptFailed, snsClient.events[0].EventType)
+
+	out := logs.String()
+	assert.Contains(t, out, `"fields":["total"]`)
+	assert.Contains(t, out, "receipt validation failed")
+	assert.NotContains(t, out, "987.65")
+	assert.NotContains(t, out, "6.49")
+}
+
+func TestProcessMessage_SpanNamedAfterQueue(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	logger := logging.New(&bytes.Buffer{}, slog.LevelInfo)
+	service := receipt.NewReceiptService(receipt.NewInMemoryStore(), receipt.NewDefaultPointsCalculator(), receipt.WithLogger(logger))
+	p := NewProcessor(&fakeSQS{}, &fakeSNS{}, service, "orders-queue", logger)
+
+	body := `{"id":"r1","retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01",` +
+		`"items":[{"shortDescription":"Mountain Dew 12PK","price":"6.49"}],"total":"6.49"}`
+	require.NoError(t, p.ProcessMessage(context.Background(), &sqs.Message{MessageId: awsg.String("m1"), Body: awsg.String(body)}))
+
+	var names []string
+	for _, span := range recorder.Ended() {
+		if span.SpanKind() == trace.SpanKindConsumer {
+			names = append(names, span.Name())
+		}
+	}
+	assert.Equal(t, []string{"orders-queue process"}, names)
+}
@@ -0,0 +1,72 @@
+package worker
+
+import (
+	stderrors "errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/kartikeya55555/fetch-assignment/internal/errors"
+)
+
+const (
+	retryBaseDelay = 2 * time.Second
+	retryMaxDelay  = 5 * time.Minute
+)
+
+// IsPermanent reports whether a ProcessMessage error will fail again on
+// retry (bad payload, invalid receipt). Such messages should be deleted;
+// anything else (e.g. store failures) is worth retrying.
+func IsPermanent(err error) bool {
+	return stderrors.Is(err, errors.ErrMalformedMessage) ||
+		stderrors.Is(err, errors.ErrReceiptValidation)
+}
+
+// loggableError stands in for err in logs. Validation errors quote receipt
+// amounts, so only their sentinel is kept; the failing fields are logged
+// separately.
+func loggableError(err error) error {
+	if stderrors.Is(err, errors.ErrReceiptValidation) {
+		return errors.ErrReceiptValidation
+	}
+	return err
+}
+
+// RetryDelay returns the exponential backoff before the next delivery of a
+// message that has already been received receiveCount times.
+func RetryDelay(receiveCount int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < receiveCount && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay
+}
+
+// ReceiveCount reads SQS's ApproximateReceiveCount for msg, defaulting to 1.
+func ReceiveCount(msg *sqs.Message) int {
+	raw, ok := msg.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]
+	if !ok || raw == nil {
+		return 1
+	}
+	n, err := strconv.Atoi(*raw)
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// SentAt reads SQS's SentTimestamp for msg; ok is false if it is missing.
+func SentAt(msg *sqs.Message) (t time.Time, ok bool) {
+	raw, ok := msg.Attributes[sqs.MessageSystemAttributeNameSentTimestamp]
+	if !ok || raw == nil {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(*raw, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	awsg "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/kartikeya55555/fetch-assignment/internal/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPermanent(t *testing.T) {
+	assert.True(t, IsPermanent(fmt.Errorf("wrapped: %w", errors.ErrReceiptValidation)))
+	assert.True(t, IsPermanent(fmt.Errorf("wrapped: %w", errors.ErrMalformedMessage)))
+	assert.False(t, IsPermanent(fmt.Errorf("database is locked")))
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, 2*time.Second, RetryDelay(1))
+	assert.Equal(t, 4*time.Second, RetryDelay(2))
+	assert.Equal(t, 16*time.Second, RetryDelay(4))
+	assert.Equal(t, 5*time.Minute, RetryDelay(50))
+}
+
+func TestReceiveCount(t *testing.T) {
+	msg := &sqs.Message{Attributes: map[string]*string{
+		sqs.MessageSystemAttributeNameApproximateReceiveCount: awsg.String("3"),
+	}}
+	assert.Equal(t, 3, ReceiveCount(msg))
+	assert.Equal(t, 1, ReceiveCount(&sqs.Message{}))
+}
+
+func TestSentAt(t *testing.T) {
+	msg := &sqs.Message{Attributes: map[string]*string{
+		sqs.MessageSystemAttributeNameSentTimestamp: awsg.String("1700000000123"),
+	}}
+	sent, ok := SentAt(msg)
+	assert.True(t, ok)
+	assert.Equal(t, time.UnixMilli(1700000000123), sent)
+
+	_, ok = SentAt(&sqs.Message{})
+	assert.False(t, ok)
+}